@@ -2,11 +2,20 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"test_task/internal/pkg/app"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := app.Migrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Print("start")
 
 	App, err := app.New()
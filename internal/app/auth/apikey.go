@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+)
+
+const apiKeyHeader = "x-api-key"
+
+// APIKeys authenticates requests by static key passed in x-api-key metadata
+type APIKeys struct {
+	keys map[string]string
+}
+
+func newAPIKeys(keys map[string]string) *APIKeys {
+	return &APIKeys{keys: keys}
+}
+
+func (a *APIKeys) Authenticate(ctx context.Context, md metadata.MD) (string, error) {
+	values := md.Get(apiKeyHeader)
+	if len(values) == 0 {
+		return "", ErrNoCredentials
+	}
+
+	for key, client := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(values[0])) == 1 {
+			return client, nil
+		}
+	}
+
+	return "", errors.New("unknown api key")
+}
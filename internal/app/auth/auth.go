@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+	"test_task/internal/app/interceptor"
+)
+
+const (
+	adminServicePrefix  = "/api.AdminService/"
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+// Anonymous is the name of the identity of every caller when authentication is disabled
+const Anonymous = "anonymous"
+
+// ErrNoCredentials is returned by Authenticator if the request has no credentials of its kind
+var ErrNoCredentials = errors.New("no credentials")
+
+type Authenticator interface {
+	// Authenticate returns name of the client which sent the request
+	Authenticate(ctx context.Context, md metadata.MD) (string, error)
+}
+
+// Client is an entry of clients file. InvIds and UnitGuids are glob patterns
+// (e.g. "G-04*"), a unit is accessible when either of them matches.
+// Zero limits are replaced by the defaults of the rate limiter
+type Client struct {
+	Name      string   `json:"name"`
+	APIKeys   []string `json:"api_keys"`
+	Admin     bool     `json:"admin"`
+	InvIds    []string `json:"invids"`
+	UnitGuids []string `json:"unit_guids"`
+
+	RateLimit   float64 `json:"rate_limit"`
+	Burst       int     `json:"burst"`
+	MaxPageSize int32   `json:"max_page_size"`
+}
+
+type clientsFile struct {
+	Clients []Client `json:"clients"`
+}
+
+// Identity is attached to the context of every authenticated request
+type Identity struct {
+	Client
+}
+
+type identityKey struct{}
+
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// AllowsAll reports whether the client may read any unit
+func (i *Identity) AllowsAll() bool {
+	if i == nil {
+		return false
+	}
+
+	return allowsAll(i.InvIds) || allowsAll(i.UnitGuids)
+}
+
+// allowsAll looks for a literal * entry, other patterns which happen to match
+// the string "*", like "?", do not allow every unit
+func allowsAll(patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsGuid checks guid patterns only, use Allows when invid is known
+func (i *Identity) AllowsGuid(guid uuid.UUID) bool {
+	if i == nil {
+		return false
+	}
+
+	return matchAny(i.UnitGuids, guid.String())
+}
+
+func (i *Identity) Allows(guid uuid.UUID, invId string) bool {
+	if i == nil {
+		return false
+	}
+
+	return matchAny(i.UnitGuids, guid.String()) || matchAny(i.InvIds, invId)
+}
+
+// UnitsFilter returns access rules of the client as a database filter, nil when all units are allowed
+func (i *Identity) UnitsFilter() *database.UnitsFilter {
+	if i == nil {
+		return &database.UnitsFilter{}
+	}
+	if i.AllowsAll() {
+		return nil
+	}
+
+	return &database.UnitsFilter{InvIds: i.InvIds, UnitGuids: i.UnitGuids}
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if database.MatchGlob(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Auth struct {
+	enabled        bool
+	clients        map[string]*Client
+	authenticators []Authenticator
+}
+
+func New(cfg config.Auth) (*Auth, error) {
+	a := &Auth{}
+	a.clients = make(map[string]*Client)
+
+	if cfg.Disabled {
+		log.Print("authentication is disabled by AUTH_DISABLED, every caller has admin access")
+		return a, nil
+	}
+	if cfg.ClientsFile == "" {
+		return nil, errors.New("AUTH_CLIENTS_FILE is not set, set AUTH_DISABLED=true to run without authentication")
+	}
+	a.enabled = true
+
+	clients, err := loadClients(cfg.ClientsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string)
+	for i := range clients {
+		a.clients[clients[i].Name] = &clients[i]
+		for _, key := range clients[i].APIKeys {
+			keys[key] = clients[i].Name
+		}
+	}
+	a.authenticators = append(a.authenticators, newAPIKeys(keys))
+
+	if cfg.JWKSFile != "" {
+		jwtAuth, err := newJWT(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.authenticators = append(a.authenticators, jwtAuth)
+	}
+
+	return a, nil
+}
+
+func loadClients(path string) ([]Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read clients file")
+	}
+
+	var file clientsFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse clients file")
+	}
+
+	// patterns are also matched by database queries, which do not support character classes
+	for _, client := range file.Clients {
+		for _, pattern := range append(append([]string{}, client.InvIds...), client.UnitGuids...) {
+			if strings.ContainsAny(pattern, `[\`) {
+				return nil, errors.Errorf("client %s: pattern %q: only * and ? wildcards are supported", client.Name, pattern)
+			}
+		}
+	}
+
+	return file.Clients, nil
+}
+
+func (a *Auth) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			audit(ctx, identity, info.FullMethod, req, err)
+			return nil, err
+		}
+
+		resp, err := handler(context.WithValue(ctx, identityKey{}, identity), req)
+		audit(ctx, identity, info.FullMethod, req, err)
+
+		return resp, err
+	}
+}
+
+func (a *Auth) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			audit(ss.Context(), identity, info.FullMethod, nil, err)
+			return err
+		}
+
+		wrapped := &identityStream{ServerStream: ss}
+		wrapped.ctx = context.WithValue(ss.Context(), identityKey{}, identity)
+
+		err = handler(srv, wrapped)
+		audit(ss.Context(), identity, info.FullMethod, wrapped.req, err)
+
+		return err
+	}
+}
+
+// IsPublic reports whether the method is available without credentials, e.g. for health probes
+func IsPublic(method string) bool {
+	return strings.HasPrefix(method, healthServicePrefix)
+}
+
+func (a *Auth) authorize(ctx context.Context, method string) (*Identity, error) {
+	if IsPublic(method) {
+		return &Identity{Client{Name: "public"}}, nil
+	}
+
+	if !a.enabled {
+		return &Identity{Client{Name: Anonymous, Admin: true, InvIds: []string{"*"}}}, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, authenticator := range a.authenticators {
+		name, err := authenticator.Authenticate(ctx, md)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid credentials: %v", err)
+		}
+
+		client, ok := a.clients[name]
+		if !ok {
+			return nil, status.Errorf(codes.PermissionDenied, "client %q has no access rules", name)
+		}
+
+		identity := &Identity{*client}
+		if strings.HasPrefix(method, adminServicePrefix) && !identity.Admin {
+			return identity, status.Error(codes.PermissionDenied, "admin access is required")
+		}
+
+		return identity, nil
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "credentials are required")
+}
+
+func audit(ctx context.Context, identity *Identity, method string, req interface{}, err error) {
+	client := "-"
+	if identity != nil {
+		client = identity.Name
+	}
+	requestID := interceptor.RequestIDFromContext(ctx)
+
+	if req != nil {
+		log.Printf("audit: request_id=%s client=%s method=%s code=%s request={%v}",
+			requestID, client, method, status.Code(err), req)
+	} else {
+		log.Printf("audit: request_id=%s client=%s method=%s code=%s", requestID, client, method, status.Code(err))
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	// req is the first message of the client for audit log
+	req interface{}
+}
+
+func (s *identityStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = m
+	}
+
+	return err
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+var testGuid = uuid.FromStringOrNil("1d7e4b4c-5a3e-4c4f-9b1a-6f0c2a7d8e01")
+
+func TestAllowsAllNeedsLiteralStar(t *testing.T) {
+	checks := []struct {
+		invIds []string
+		want   bool
+	}{
+		{[]string{"*"}, true},
+		{[]string{"G-04*", "*"}, true},
+		{[]string{"?"}, false},
+		{[]string{"?*"}, false},
+		{[]string{"*?"}, false},
+		{nil, false},
+	}
+	for _, check := range checks {
+		identity := &Identity{Client: Client{InvIds: check.invIds}}
+		if got := identity.AllowsAll(); got != check.want {
+			t.Errorf("AllowsAll of invids %q = %v, want %v", check.invIds, got, check.want)
+		}
+		if got := identity.UnitsFilter() == nil; got != check.want {
+			t.Errorf("UnitsFilter of invids %q is nil = %v, want %v", check.invIds, got, check.want)
+		}
+	}
+}
+
+func TestAllowsMatchesSlashes(t *testing.T) {
+	identity := &Identity{Client: Client{InvIds: []string{"site*"}}}
+
+	// databases match * across / too, so filtered listings and checks agree
+	if !identity.Allows(testGuid, "site/7") {
+		t.Fatal("site* does not allow invid site/7")
+	}
+	if identity.Allows(testGuid, "other/7") {
+		t.Fatal("site* allows invid other/7")
+	}
+}
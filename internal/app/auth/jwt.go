@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+
+	"test_task/internal/app/config"
+)
+
+// JWT authenticates requests by bearer token signed with one of the keys of
+// a local JWKS file, the subject of the token is the client name
+type JWT struct {
+	jwks     *keyfunc.JWKS
+	issuer   string
+	audience string
+}
+
+func newJWT(cfg config.Auth) (*JWT, error) {
+	data, err := os.ReadFile(cfg.JWKSFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read JWKS file")
+	}
+
+	j := &JWT{}
+	j.issuer = cfg.JWTIssuer
+	j.audience = cfg.JWTAudience
+
+	j.jwks, err = keyfunc.NewJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse JWKS file")
+	}
+
+	return j, nil
+}
+
+func (j *JWT) Authenticate(ctx context.Context, md metadata.MD) (string, error) {
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return "", ErrNoCredentials
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(values[0], "Bearer "), claims, j.jwks.Keyfunc)
+	if err != nil {
+		return "", err
+	}
+
+	if j.issuer != "" && !claims.VerifyIssuer(j.issuer, true) {
+		return "", errors.New("unexpected token issuer")
+	}
+	if j.audience != "" && !claims.VerifyAudience(j.audience, true) {
+		return "", errors.New("unexpected token audience")
+	}
+	if claims.Subject == "" {
+		return "", errors.New("token has no subject")
+	}
+
+	return claims.Subject, nil
+}
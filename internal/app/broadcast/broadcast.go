@@ -0,0 +1,168 @@
+package broadcast
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+)
+
+var ErrSlowSubscriber = errors.New("subscriber is too slow, records were dropped")
+
+type IBroadcaster interface {
+	Run(ctx context.Context)
+	// Publish delivers records added from the file
+	Publish(ctx context.Context, file string, records []database.Record) error
+
+	Subscribe(filter Filter) *Subscription
+	Unsubscribe(sub *Subscription)
+}
+
+// Filter selects records for a subscription, empty fields match everything
+type Filter struct {
+	Guid    uuid.UUID
+	Classes []string
+	Levels  []int
+	// Allowed restricts records to the ones the subscriber has access to
+	Allowed func(record *database.Record) bool
+}
+
+func (f *Filter) match(record *database.Record) bool {
+	if f.Allowed != nil && !f.Allowed(record) {
+		return false
+	}
+
+	if f.Guid != uuid.Nil && f.Guid != record.UnitGuid {
+		return false
+	}
+
+	if len(f.Classes) > 0 {
+		found := false
+		for _, class := range f.Classes {
+			if class == record.Class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Levels) > 0 {
+		found := false
+		for _, level := range f.Levels {
+			if level == record.Level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Subscription struct {
+	filter  Filter
+	records chan database.Record
+	err     error
+}
+
+// Records is closed when subscription is cancelled or the subscriber could not keep up
+func (s *Subscription) Records() <-chan database.Record {
+	return s.records
+}
+
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Broadcaster delivers published records to subscribers of the same process
+type Broadcaster struct {
+	mu         sync.Mutex
+	subs       map[*Subscription]struct{}
+	bufferSize int
+}
+
+func New(cfg config.Watch, db database.IDatabase, errChan chan error) (IBroadcaster, error) {
+	b := &Broadcaster{}
+
+	b.subs = make(map[*Subscription]struct{})
+	b.bufferSize = cfg.BufferSize
+
+	switch cfg.Mode {
+	case "", "local":
+		return b, nil
+	case "postgres":
+		notifier, ok := db.(Notifier)
+		if !ok {
+			return nil, errors.New("database does not support notifications")
+		}
+		return newPGBroadcaster(b, notifier, errChan), nil
+	default:
+		return nil, errors.Errorf("unknown watch mode %q", cfg.Mode)
+	}
+}
+
+func (b *Broadcaster) Run(ctx context.Context) {}
+
+func (b *Broadcaster) Publish(ctx context.Context, file string, records []database.Record) error {
+	b.deliver(records)
+
+	return nil
+}
+
+func (b *Broadcaster) Subscribe(filter Filter) *Subscription {
+	sub := &Subscription{}
+	sub.filter = filter
+	sub.records = make(chan database.Record, b.bufferSize)
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.records)
+	}
+}
+
+func (b *Broadcaster) deliver(records []database.Record) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		for i := range records {
+			if !sub.filter.match(&records[i]) {
+				continue
+			}
+
+			select {
+			case sub.records <- records[i]:
+			default:
+				// never block ingestion because of one slow client
+				sub.err = ErrSlowSubscriber
+				delete(b.subs, sub)
+				close(sub.records)
+			}
+
+			if sub.err != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/database"
+)
+
+const (
+	notifyChannel = "data_added"
+	relistenDelay = 5 * time.Second
+)
+
+// Notifier is implemented by databases which can pass messages between service instances
+type Notifier interface {
+	Notify(ctx context.Context, channel string, payloads []string) error
+	Listen(ctx context.Context, channel string, fn func(payload string)) error
+	GetFileRecords(ctx context.Context, file string, guid uuid.UUID) ([]database.Record, error)
+}
+
+// notification refers to records of a unit added from a file, records themselves
+// do not fit the 8000 bytes limit of NOTIFY payload
+type notification struct {
+	File     string    `json:"file"`
+	UnitGuid uuid.UUID `json:"unit_guid"`
+}
+
+// PGBroadcaster sends references to published records through Postgres NOTIFY, so subscribers
+// of every instance listening on the channel load and receive them
+type PGBroadcaster struct {
+	*Broadcaster
+	notifier Notifier
+
+	errChan chan error
+}
+
+func newPGBroadcaster(b *Broadcaster, notifier Notifier, errChan chan error) *PGBroadcaster {
+	pg := &PGBroadcaster{}
+
+	pg.Broadcaster = b
+	pg.notifier = notifier
+	pg.errChan = errChan
+
+	return pg
+}
+
+func (b *PGBroadcaster) Run(ctx context.Context) {
+	for {
+		err := b.notifier.Listen(ctx, notifyChannel, func(payload string) {
+			b.receive(ctx, payload)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		b.errChan <- errors.Errorf("listen notifications error: %v", err)
+
+		time.Sleep(relistenDelay)
+	}
+}
+
+// Publish doesn't deliver records locally, they come back through Listen like for other instances.
+// One notification is sent for every unit of the file
+func (b *PGBroadcaster) Publish(ctx context.Context, file string, records []database.Record) error {
+	var payloads []string
+	sent := make(map[uuid.UUID]struct{})
+	for _, record := range records {
+		if _, ok := sent[record.UnitGuid]; ok {
+			continue
+		}
+		sent[record.UnitGuid] = struct{}{}
+
+		payload, err := json.Marshal(notification{File: file, UnitGuid: record.UnitGuid})
+		if err != nil {
+			return err
+		}
+
+		payloads = append(payloads, string(payload))
+	}
+
+	return b.notifier.Notify(ctx, notifyChannel, payloads)
+}
+
+func (b *PGBroadcaster) receive(ctx context.Context, payload string) {
+	var n notification
+	err := json.Unmarshal([]byte(payload), &n)
+	if err != nil {
+		b.errChan <- errors.Errorf("decode notification error: %v", err)
+		return
+	}
+
+	records, err := b.notifier.GetFileRecords(ctx, n.File, n.UnitGuid)
+	if err != nil {
+		b.errChan <- errors.Errorf("load notified records error: %v", err)
+		return
+	}
+
+	b.deliver(records)
+}
@@ -0,0 +1,94 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"test_task/internal/app/database"
+)
+
+// Postgres is the only database which can broadcast between instances
+var _ Notifier = (*database.Postgres)(nil)
+
+var (
+	guidA = uuid.FromStringOrNil("1d7e4b4c-5a3e-4c4f-9b1a-6f0c2a7d8e01")
+	guidB = uuid.FromStringOrNil("8b2f0c1e-2d4a-4e6b-8c3d-9a1b2c3d4e02")
+)
+
+// fakeNotifier delivers notifications synchronously and loads records from a memory database
+type fakeNotifier struct {
+	*database.Memory
+	listener func(payload string)
+	payloads []string
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, channel string, payloads []string) error {
+	n.payloads = append(n.payloads, payloads...)
+	for _, payload := range payloads {
+		n.listener(payload)
+	}
+
+	return nil
+}
+
+func (n *fakeNotifier) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	n.listener = fn
+
+	return nil
+}
+
+func (n *fakeNotifier) GetFileRecords(ctx context.Context, file string, guid uuid.UUID) ([]database.Record, error) {
+	return n.GetRecordsByGuid(ctx, guid)
+}
+
+func TestPGBroadcasterNotifiesReferences(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.NewMemory()
+	err := db.AddProcessedFile(ctx, "a.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// large text must not reach NOTIFY payload
+	text := string(make([]byte, 10000))
+	records := []database.Record{
+		{N: 1, UnitGuid: guidA, Class: "alarm", Text: text},
+		{N: 2, UnitGuid: guidB, Class: "alarm"},
+		{N: 3, UnitGuid: guidA, Class: "working"},
+	}
+	err = db.AddDataRow(ctx, "a.tsv", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &fakeNotifier{Memory: db}
+	b := newPGBroadcaster(&Broadcaster{subs: make(map[*Subscription]struct{}), bufferSize: 10}, notifier, make(chan error, 1))
+	notifier.listener = func(payload string) {
+		b.receive(ctx, payload)
+	}
+
+	sub := b.Subscribe(Filter{Guid: guidA})
+	err = b.Publish(ctx, "a.tsv", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notifier.payloads) != 2 {
+		t.Fatalf("sent %d notifications, want one per unit", len(notifier.payloads))
+	}
+	for _, payload := range notifier.payloads {
+		if len(payload) > 200 {
+			t.Fatalf("notification has %d bytes, want a reference", len(payload))
+		}
+	}
+
+	for _, n := range []int{1, 3} {
+		record := <-sub.Records()
+		if record.N != n {
+			t.Fatalf("received record %d, want %d", record.N, n)
+		}
+	}
+}
@@ -2,23 +2,40 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
 )
 
 type Config struct {
 	Database       DB
 	FilesDirectory FilesDirectory
 	Parser         Parser
+	Watch          Watch
+	Gateway        Gateway
+	GRPC           GRPC
+	Auth           Auth
+	Health         Health
+	RateLimit      RateLimit
+	Metrics        Metrics
+	Tracing        Tracing
+	Retention      Retention
 }
 
 type DB struct {
+	// Driver is "postgres", "sqlite" or "memory" for dry runs without persistence
+	Driver       string `env:"DB_DRIVER" envDefault:"postgres"`
 	Host         string `env:"DB_HOST"`
 	Port         int    `env:"DB_PORT"`
 	User         string `env:"DB_USER"`
 	Password     string `env:"DB_PASSWORD"`
 	DatabaseName string `env:"DB_NAME"`
+	// SQLitePath is a database file of sqlite driver
+	SQLitePath string `env:"DB_SQLITE_PATH"`
+	// AutoMigrate applies pending schema migrations on start
+	AutoMigrate bool `env:"DB_AUTO_MIGRATE"`
 }
 
 type FilesDirectory struct {
@@ -27,7 +44,111 @@ type FilesDirectory struct {
 }
 
 type Parser struct {
-	OutFilesDirectory string `env:"OUT_FILE_DIRECTORY"`
+	OutFile OutFile
+	// RulesFile is a JSON file with validation rules of parsed rows, they replace default rules column by column
+	RulesFile string `env:"VALIDATION_RULES_FILE"`
+}
+
+type OutFile struct {
+	Directory string `env:"OUT_FILE_DIRECTORY"`
+	// Formats are formats of files written for every unit_guid: pdf, rtf, docx, csv, xlsx
+	Formats []string `env:"OUT_FILE_FORMATS" envSeparator:"," envDefault:"pdf"`
+	// PDFRenderer is "fpdf" to work offline or "unipdf" which needs a metered PDF_API_KEY
+	PDFRenderer string `env:"PDF_RENDERER" envDefault:"fpdf"`
+	// Debounce delays regeneration of a unit_guid until its data stop changing for this long,
+	// 0 regenerates right after every input file
+	Debounce time.Duration `env:"OUT_FILE_DEBOUNCE" envDefault:"5s"`
+	// KeepVersions is how many timestamped versions of a file are kept behind the <unit_guid>.<extension>
+	// symlink to the latest one, 0 replaces the file itself
+	KeepVersions int `env:"OUT_FILE_KEEP_VERSIONS"`
+	// OverviewInterval is how often overview.<extension> of all units is written, 0 disables it
+	OverviewInterval time.Duration `env:"OUT_FILE_OVERVIEW_INTERVAL" envDefault:"24h"`
+	// ReportMaxRecords limits reports generated on request, larger ones are rejected before rendering
+	ReportMaxRecords int64 `env:"REPORT_MAX_RECORDS" envDefault:"100000"`
+}
+
+type Watch struct {
+	// Mode is "local" for in-process delivery or "postgres" for LISTEN/NOTIFY between instances
+	Mode       string `env:"WATCH_MODE" envDefault:"local"`
+	BufferSize int    `env:"WATCH_BUFFER_SIZE" envDefault:"256"`
+}
+
+type Gateway struct {
+	// Address is empty to disable HTTP/JSON gateway
+	Address      string `env:"HTTP_ADDRESS"`
+	GRPCEndpoint string `env:"HTTP_GRPC_ENDPOINT" envDefault:"localhost:5300"`
+	// GRPCCAFile enables TLS to the gRPC server, cert and key are needed when it requires client certificates
+	GRPCCAFile     string `env:"HTTP_GRPC_TLS_CA"`
+	GRPCCertFile   string `env:"HTTP_GRPC_TLS_CERT"`
+	GRPCKeyFile    string `env:"HTTP_GRPC_TLS_KEY"`
+	GRPCServerName string `env:"HTTP_GRPC_TLS_SERVER_NAME"`
+}
+
+type GRPC struct {
+	Address string `env:"GRPC_ADDRESS" envDefault:":5300"`
+	// TLS is enabled when cert and key are set, ClientCAFile additionally requires client certificates
+	CertFile     string `env:"GRPC_TLS_CERT"`
+	KeyFile      string `env:"GRPC_TLS_KEY"`
+	ClientCAFile string `env:"GRPC_TLS_CLIENT_CA"`
+
+	MaxRecvMsgSize int `env:"GRPC_MAX_RECV_MSG_SIZE" envDefault:"4194304"`
+	MaxSendMsgSize int `env:"GRPC_MAX_SEND_MSG_SIZE" envDefault:"4194304"`
+
+	KeepaliveTime                time.Duration `env:"GRPC_KEEPALIVE_TIME" envDefault:"2h"`
+	KeepaliveTimeout             time.Duration `env:"GRPC_KEEPALIVE_TIMEOUT" envDefault:"20s"`
+	KeepaliveMinTime             time.Duration `env:"GRPC_KEEPALIVE_MIN_TIME" envDefault:"5m"`
+	KeepalivePermitWithoutStream bool          `env:"GRPC_KEEPALIVE_PERMIT_WITHOUT_STREAM"`
+	MaxConnectionIdle            time.Duration `env:"GRPC_MAX_CONNECTION_IDLE"`
+	MaxConnectionAge             time.Duration `env:"GRPC_MAX_CONNECTION_AGE"`
+	MaxConnectionAgeGrace        time.Duration `env:"GRPC_MAX_CONNECTION_AGE_GRACE"`
+}
+
+type Auth struct {
+	// ClientsFile is a JSON file with API keys and access rules of clients, it is required unless Disabled
+	ClientsFile string `env:"AUTH_CLIENTS_FILE"`
+	// Disabled lets every caller read all units as admin, it is meant for local development only
+	Disabled    bool   `env:"AUTH_DISABLED"`
+	JWKSFile    string `env:"AUTH_JWKS_FILE"`
+	JWTIssuer   string `env:"AUTH_JWT_ISSUER"`
+	JWTAudience string `env:"AUTH_JWT_AUDIENCE"`
+}
+
+type Health struct {
+	Interval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"5s"`
+	// WatcherStaleAfter is how long the files directory may go without a full scan
+	WatcherStaleAfter time.Duration `env:"HEALTH_WATCHER_STALE_AFTER" envDefault:"1m"`
+	MaxQueueDepth     int           `env:"HEALTH_MAX_QUEUE_DEPTH" envDefault:"900"`
+}
+
+// RateLimit holds defaults for clients without own limits in the clients file
+type RateLimit struct {
+	// RPS is requests per second of one client, 0 disables rate limiting
+	RPS         float64 `env:"RATE_LIMIT_RPS" envDefault:"20"`
+	Burst       int     `env:"RATE_LIMIT_BURST" envDefault:"40"`
+	MaxPageSize int32   `env:"MAX_PAGE_SIZE" envDefault:"1000"`
+}
+
+type Metrics struct {
+	// Address is empty to disable /metrics endpoint
+	Address string `env:"METRICS_ADDRESS"`
+}
+
+type Tracing struct {
+	// Exporter is "otlp", "file" or empty to disable tracing
+	Exporter     string  `env:"TRACING_EXPORTER"`
+	OTLPEndpoint string  `env:"TRACING_OTLP_ENDPOINT" envDefault:"localhost:4317"`
+	OTLPInsecure bool    `env:"TRACING_OTLP_INSECURE"`
+	File         string  `env:"TRACING_FILE"`
+	ServiceName  string  `env:"TRACING_SERVICE_NAME" envDefault:"biocad-test-task"`
+	SampleRatio  float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+}
+
+type Retention struct {
+	// Months is how many past months of data are kept besides the current one, 0 keeps everything
+	Months int `env:"RETENTION_MONTHS"`
+	// ArchiveDirectory receives dropped months as gzipped TSV, they are dropped without archive when it is empty
+	ArchiveDirectory string        `env:"RETENTION_ARCHIVE_DIRECTORY"`
+	Interval         time.Duration `env:"RETENTION_INTERVAL" envDefault:"1h"`
 }
 
 func New() (*Config, error) {
@@ -41,9 +162,23 @@ func New() (*Config, error) {
 		return nil, err
 	}
 
+	err = cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+func (cfg *Config) validate() error {
+	// a bucket without burst rejects every request
+	if cfg.RateLimit.RPS > 0 && cfg.RateLimit.Burst < 1 {
+		return errors.Errorf("RATE_LIMIT_BURST is %d, it must be at least 1 when RATE_LIMIT_RPS is set", cfg.RateLimit.Burst)
+	}
+
+	return nil
+}
+
 func loadEnv() error {
 	err := godotenv.Load(os.Getenv("ENV_FILE"))
 	if err != nil {
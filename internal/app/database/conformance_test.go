@@ -0,0 +1,618 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/database"
+)
+
+// timePrecision is the coarsest time precision among implementations, Postgres keeps microseconds
+const timePrecision = time.Millisecond
+
+var (
+	guidA = uuid.FromStringOrNil("1d7e4b4c-5a3e-4c4f-9b1a-6f0c2a7d8e01")
+	guidB = uuid.FromStringOrNil("8b2f0c1e-2d4a-4e6b-8c3d-9a1b2c3d4e02")
+)
+
+type testCase struct {
+	name string
+	run  func(ctx context.Context, db database.IDatabase) error
+}
+
+var cases = []testCase{
+	{"files", testFiles},
+	{"list files", testListFiles},
+	{"records", testRecords},
+	{"units", testUnits},
+	{"units filter", testUnitsFilter},
+	{"stream records", testStreamRecords},
+	{"clear file data", testClearFileData},
+}
+
+// runConformance runs every case against a fresh empty database made by open,
+// so that all implementations of database.IDatabase behave the same way
+func runConformance(t *testing.T, open func(t *testing.T) database.IDatabase) {
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			err := c.run(context.Background(), open(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func testFiles(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv", "b.tsv")
+	if err != nil {
+		return err
+	}
+
+	if db.AddProcessedFile(ctx, "a.tsv") == nil {
+		return errors.New("adding a file twice must fail")
+	}
+
+	files, err := db.GetProcessedFiles(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, []string{"a.tsv", "b.tsv"}) {
+		return errors.Errorf("GetProcessedFiles = %v, want [a.tsv b.tsv]", files)
+	}
+
+	file, fileErrors, err := db.GetFile(ctx, "a.tsv")
+	if err != nil {
+		return err
+	}
+	if file == nil || file.Status != database.FileQueued || file.ProcessedAt != nil || len(fileErrors) != 0 {
+		return errors.Errorf("new file = %+v with errors %v, want queued file without errors", file, fileErrors)
+	}
+
+	processedAt := time.Now()
+	want := database.File{Name: "a.tsv", Status: database.FileFailed, RowsTotal: 3, RowsParsed: 1, RowsRejected: 2,
+		Error: "bad file", AddedAt: file.AddedAt, ProcessedAt: &processedAt}
+	err = db.UpdateFile(ctx, want)
+	if err != nil {
+		return err
+	}
+
+	err = db.AddFileErrors(ctx, "a.tsv", []database.FileError{{Line: 3, Error: "third"}, {Line: 2, Error: "second"}})
+	if err != nil {
+		return err
+	}
+
+	file, fileErrors, err = db.GetFile(ctx, "a.tsv")
+	if err != nil {
+		return err
+	}
+	if file == nil || !filesEqual(*file, want) {
+		return errors.Errorf("updated file = %+v, want %+v", file, want)
+	}
+	wantErrors := []database.FileError{{Line: 2, Error: "second"}, {Line: 3, Error: "third"}}
+	if !reflect.DeepEqual(fileErrors, wantErrors) {
+		return errors.Errorf("file errors = %v, want %v ordered by line", fileErrors, wantErrors)
+	}
+
+	file, _, err = db.GetFile(ctx, "missing.tsv")
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		return errors.Errorf("GetFile of unknown file = %+v, want nil", file)
+	}
+
+	return nil
+}
+
+func testListFiles(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "first.tsv", "second.tsv", "third.tsv")
+	if err != nil {
+		return err
+	}
+
+	processedAt := time.Now()
+	err = db.UpdateFile(ctx, database.File{Name: "second.tsv", Status: database.FileProcessed, ProcessedAt: &processedAt})
+	if err != nil {
+		return err
+	}
+
+	checks := []struct {
+		filter database.FilesFilter
+		want   []string
+	}{
+		{database.FilesFilter{Limit: 10}, []string{"third.tsv", "second.tsv", "first.tsv"}},
+		{database.FilesFilter{Limit: 2}, []string{"third.tsv", "second.tsv"}},
+		{database.FilesFilter{Offset: 1, Limit: 10}, []string{"second.tsv", "first.tsv"}},
+		{database.FilesFilter{Offset: 3, Limit: 10}, nil},
+		{database.FilesFilter{Status: database.FileProcessed, Limit: 10}, []string{"second.tsv"}},
+		{database.FilesFilter{Name: "ir", Limit: 10}, []string{"third.tsv", "first.tsv"}},
+	}
+
+	for _, check := range checks {
+		files, err := db.ListFiles(ctx, check.filter)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		if !reflect.DeepEqual(names, check.want) {
+			return errors.Errorf("ListFiles(%+v) = %v, want %v", check.filter, names, check.want)
+		}
+	}
+
+	return nil
+}
+
+func testRecords(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv")
+	if err != nil {
+		return err
+	}
+
+	records := testRecordsOf("inv-1", guidA, guidB, guidA, guidA, guidB)
+	err = db.AddDataRow(ctx, "a.tsv", records)
+	if err != nil {
+		return err
+	}
+
+	wantA := filterRecords(records, guidA)
+
+	got, err := db.GetRecordsByGuid(ctx, guidA)
+	if err != nil {
+		return err
+	}
+	if !recordsEqual(got, wantA) {
+		return errors.Errorf("GetRecordsByGuid = %+v, want %+v in ingestion order", got, wantA)
+	}
+
+	checks := []struct {
+		offset, limit int32
+		want          []database.Record
+	}{
+		{0, 10, wantA},
+		{0, 2, wantA[:2]},
+		{1, 2, wantA[1:3]},
+		{3, 2, nil},
+	}
+
+	for _, check := range checks {
+		got, err = db.GetDataAPI(ctx, guidA, check.offset, check.limit)
+		if err != nil {
+			return err
+		}
+		if !recordsEqual(got, check.want) {
+			return errors.Errorf("GetDataAPI(offset %d, limit %d) = %+v, want %+v", check.offset, check.limit,
+				got, check.want)
+		}
+	}
+
+	later := time.Now().Add(time.Hour)
+	filters := []struct {
+		filter database.RecordsFilter
+		want   []database.Record
+	}{
+		{database.RecordsFilter{}, wantA},
+		{database.RecordsFilter{Levels: []int{0}}, []database.Record{wantA[0], wantA[2]}},
+		{database.RecordsFilter{Classes: []string{"alarm"}, Levels: []int{2}}, wantA[1:2]},
+		{database.RecordsFilter{Classes: []string{"working"}}, nil},
+		{database.RecordsFilter{To: later}, wantA},
+		{database.RecordsFilter{From: later}, nil},
+	}
+
+	for _, check := range filters {
+		got, err = db.GetRecordsByFilter(ctx, guidA, check.filter)
+		if err != nil {
+			return err
+		}
+		if !recordsEqual(got, check.want) {
+			return errors.Errorf("GetRecordsByFilter(%+v) = %+v, want %+v", check.filter, got, check.want)
+		}
+	}
+
+	stats := []struct {
+		guid   uuid.UUID
+		filter database.RecordsFilter
+		want   database.UnitStats
+	}{
+		{guidA, database.RecordsFilter{}, database.UnitStats{Records: 3, MsgIds: 3,
+			Classes: []database.Count{{Value: "alarm", Records: 3}},
+			Levels:  []database.Count{{Value: "0", Records: 2}, {Value: "2", Records: 1}},
+			Areas:   []database.Count{{Value: "LOCAL", Records: 3}}}},
+		{guidA, database.RecordsFilter{Levels: []int{2}}, database.UnitStats{Records: 1, MsgIds: 1,
+			Classes: []database.Count{{Value: "alarm", Records: 1}},
+			Levels:  []database.Count{{Value: "2", Records: 1}},
+			Areas:   []database.Count{{Value: "LOCAL", Records: 1}}}},
+		{uuid.Must(uuid.NewV4()), database.RecordsFilter{}, database.UnitStats{}},
+	}
+
+	for _, check := range stats {
+		got, err := db.GetUnitStats(ctx, check.guid, check.filter)
+		if err != nil {
+			return err
+		}
+		if got == nil || !reflect.DeepEqual(*got, check.want) {
+			return errors.Errorf("GetUnitStats(%s, %+v) = %+v, want %+v", check.guid, check.filter, got, check.want)
+		}
+	}
+
+	got, err = db.GetRecordsByGuid(ctx, uuid.Must(uuid.NewV4()))
+	if err != nil {
+		return err
+	}
+	if len(got) != 0 {
+		return errors.Errorf("records of unknown guid = %+v, want none", got)
+	}
+
+	if db.AddDataRow(ctx, "missing.tsv", records[:1]) == nil {
+		return errors.New("adding records of unknown file must fail")
+	}
+
+	return nil
+}
+
+func testUnits(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv", "b.tsv")
+	if err != nil {
+		return err
+	}
+
+	err = db.AddDataRow(ctx, "a.tsv", testRecordsOf("inv-1", guidB, guidA, guidB))
+	if err != nil {
+		return err
+	}
+
+	// invid of a unit follows the latest file
+	err = db.AddDataRow(ctx, "b.tsv", testRecordsOf("inv-2", guidB))
+	if err != nil {
+		return err
+	}
+
+	units, err := db.GetUnits(ctx, nil, 0, 10)
+	if err != nil {
+		return err
+	}
+	if len(units) != 2 {
+		return errors.Errorf("GetUnits returned %d units, want 2", len(units))
+	}
+
+	checks := []struct {
+		unit    database.Unit
+		guid    uuid.UUID
+		invId   string
+		records int64
+	}{
+		{units[0], guidA, "inv-1", 1},
+		{units[1], guidB, "inv-2", 3},
+	}
+	for _, check := range checks {
+		u := check.unit
+		if u.Guid != check.guid || u.InvId != check.invId || u.Records != check.records {
+			return errors.Errorf("unit = %+v, want guid %s, invid %s, %d records ordered by guid",
+				u, check.guid, check.invId, check.records)
+		}
+		if u.FirstSeen.IsZero() || u.LastSeen.Before(u.FirstSeen) {
+			return errors.Errorf("unit %s seen from %v to %v", u.Guid, u.FirstSeen, u.LastSeen)
+		}
+	}
+
+	units, err = db.GetUnits(ctx, nil, 1, 10)
+	if err != nil {
+		return err
+	}
+	if len(units) != 1 || units[0].Guid != guidB {
+		return errors.Errorf("GetUnits(offset 1) = %+v, want only %s", units, guidB)
+	}
+
+	// access filters are applied before the page is taken
+	filters := []struct {
+		filter *database.UnitsFilter
+		want   []uuid.UUID
+	}{
+		{&database.UnitsFilter{InvIds: []string{"inv-?"}}, []uuid.UUID{guidA, guidB}},
+		{&database.UnitsFilter{InvIds: []string{"INV-*"}}, nil},
+		{&database.UnitsFilter{InvIds: []string{"inv-2"}, UnitGuids: []string{guidA.String()[:8] + "*"}}, []uuid.UUID{guidA, guidB}},
+		{&database.UnitsFilter{UnitGuids: []string{guidB.String()}}, []uuid.UUID{guidB}},
+		{&database.UnitsFilter{}, nil},
+	}
+	for _, f := range filters {
+		units, err = db.GetUnits(ctx, f.filter, 0, 1)
+		if err != nil {
+			return err
+		}
+
+		var want []uuid.UUID
+		if len(f.want) > 0 {
+			want = f.want[:1]
+		}
+		var got []uuid.UUID
+		for _, u := range units {
+			got = append(got, u.Guid)
+		}
+		if !reflect.DeepEqual(got, want) {
+			return errors.Errorf("GetUnits(%+v, limit 1) = %v, want %v", *f.filter, got, want)
+		}
+	}
+
+	files, err := db.GetUnitFiles(ctx, guidB)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(files, []string{"a.tsv", "b.tsv"}) {
+		return errors.Errorf("GetUnitFiles = %v, want [a.tsv b.tsv] in ingestion order", files)
+	}
+
+	counts, err := db.GetClassCounts(ctx, "alarm")
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(counts, map[uuid.UUID]int64{guidA: 1, guidB: 3}) {
+		return errors.Errorf("GetClassCounts(alarm) = %v, want %s: 1, %s: 3", counts, guidA, guidB)
+	}
+
+	counts, err = db.GetClassCounts(ctx, "working")
+	if err != nil {
+		return err
+	}
+	if len(counts) != 0 {
+		return errors.Errorf("GetClassCounts(working) = %v, want none", counts)
+	}
+
+	unit, err := db.GetUnit(ctx, guidA)
+	if err != nil {
+		return err
+	}
+	if unit == nil || unit.Guid != guidA || unit.InvId != "inv-1" || unit.Records != 1 {
+		return errors.Errorf("GetUnit = %+v, want %s with 1 record", unit, guidA)
+	}
+
+	unit, err = db.GetUnit(ctx, uuid.Must(uuid.NewV4()))
+	if err != nil {
+		return err
+	}
+	if unit != nil {
+		return errors.Errorf("GetUnit of unknown guid = %+v, want nil", unit)
+	}
+
+	return nil
+}
+
+func testUnitsFilter(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv")
+	if err != nil {
+		return err
+	}
+
+	// invids may contain / which patterns match like any other character
+	err = db.AddDataRow(ctx, "a.tsv", append(testRecordsOf("site/7", guidA), testRecordsOf("site-8", guidB)...))
+	if err != nil {
+		return err
+	}
+
+	filters := []struct {
+		patterns []string
+		want     []uuid.UUID
+	}{
+		{[]string{"site*"}, []uuid.UUID{guidA, guidB}},
+		{[]string{"site/*"}, []uuid.UUID{guidA}},
+		{[]string{"*/7"}, []uuid.UUID{guidA}},
+		{[]string{"site?7"}, []uuid.UUID{guidA}},
+		{[]string{"?"}, nil},
+		{[]string{"s*t*8"}, []uuid.UUID{guidB}},
+	}
+	for _, f := range filters {
+		units, err := db.GetUnits(ctx, &database.UnitsFilter{InvIds: f.patterns}, 0, 10)
+		if err != nil {
+			return err
+		}
+
+		var got []uuid.UUID
+		for _, u := range units {
+			got = append(got, u.Guid)
+		}
+		if !reflect.DeepEqual(got, f.want) {
+			return errors.Errorf("GetUnits(invids %v) = %v, want %v", f.patterns, got, f.want)
+		}
+	}
+
+	return nil
+}
+
+func testStreamRecords(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv")
+	if err != nil {
+		return err
+	}
+
+	records := testRecordsOf("inv-1", guidA, guidB, guidA, guidB, guidB)
+	err = db.AddDataRow(ctx, "a.tsv", records)
+	if err != nil {
+		return err
+	}
+
+	var got []database.Record
+	var sizes []int
+	err = db.StreamRecordsByGuids(ctx, []uuid.UUID{guidA, guidB}, 2, func(batch []database.Record) error {
+		got = append(got, batch...)
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !recordsEqual(got, records) {
+		return errors.Errorf("streamed records = %+v, want %+v in ingestion order", got, records)
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		return errors.Errorf("batch sizes = %v, want [2 2 1]", sizes)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = db.StreamRecordsByGuids(ctx, []uuid.UUID{guidA}, 1, func(batch []database.Record) error {
+		calls++
+		return stop
+	})
+	if errors.Cause(err) != stop || calls != 1 {
+		return errors.Errorf("stream returned %v after %d calls, want error of fn after 1 call", err, calls)
+	}
+
+	return nil
+}
+
+func testClearFileData(ctx context.Context, db database.IDatabase) error {
+	err := addFiles(ctx, db, "a.tsv", "b.tsv")
+	if err != nil {
+		return err
+	}
+
+	err = db.AddDataRow(ctx, "a.tsv", testRecordsOf("inv-1", guidA, guidA))
+	if err != nil {
+		return err
+	}
+	kept := testRecordsOf("inv-1", guidA)
+	err = db.AddDataRow(ctx, "b.tsv", kept)
+	if err != nil {
+		return err
+	}
+
+	processedAt := time.Now()
+	err = db.UpdateFile(ctx, database.File{Name: "a.tsv", Status: database.FileProcessed, RowsTotal: 2,
+		RowsParsed: 2, ProcessedAt: &processedAt})
+	if err != nil {
+		return err
+	}
+	err = db.AddFileErrors(ctx, "a.tsv", []database.FileError{{Line: 1, Error: "header"}})
+	if err != nil {
+		return err
+	}
+
+	err = db.ClearFileData(ctx, "a.tsv")
+	if err != nil {
+		return err
+	}
+
+	got, err := db.GetRecordsByGuid(ctx, guidA)
+	if err != nil {
+		return err
+	}
+	if !recordsEqual(got, kept) {
+		return errors.Errorf("records after clear = %+v, want only records of other files %+v", got, kept)
+	}
+
+	file, fileErrors, err := db.GetFile(ctx, "a.tsv")
+	if err != nil {
+		return err
+	}
+	if file == nil || file.Status != database.FileQueued || file.RowsTotal != 0 || file.RowsParsed != 0 ||
+		file.ProcessedAt != nil || len(fileErrors) != 0 {
+		return errors.Errorf("file after clear = %+v with errors %v, want queued file without counts and errors",
+			file, fileErrors)
+	}
+
+	return nil
+}
+
+// addFiles adds files one by one, so that they have different added time
+func addFiles(ctx context.Context, db database.IDatabase, names ...string) error {
+	for _, name := range names {
+		err := db.AddProcessedFile(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(2 * timePrecision)
+	}
+
+	return nil
+}
+
+func testRecordsOf(invId string, guids ...uuid.UUID) []database.Record {
+	records := make([]database.Record, 0, len(guids))
+	for i, guid := range guids {
+		records = append(records, database.Record{
+			N:         i + 1,
+			MQTT:      []byte{byte(i), 0xff},
+			InvId:     invId,
+			UnitGuid:  guid,
+			MsgId:     fmt.Sprintf("cold%d", i),
+			Text:      "Разморозка",
+			Context:   []byte("context"),
+			Class:     "alarm",
+			Level:     i % 3,
+			Area:      "LOCAL",
+			Addr:      fmt.Sprintf("cold7_Defrost_status_%d", i),
+			Block:     "block",
+			Type:      "bool",
+			Bit:       i,
+			InvertBit: i % 2,
+		})
+	}
+
+	return records
+}
+
+func filterRecords(records []database.Record, guid uuid.UUID) []database.Record {
+	var filtered []database.Record
+	for _, record := range records {
+		if record.UnitGuid == guid {
+			filtered = append(filtered, record)
+		}
+	}
+
+	return filtered
+}
+
+// recordsEqual treats nil and empty byte slices as equal, drivers differ in that
+func recordsEqual(got, want []database.Record) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	for i := range got {
+		g, w := got[i], want[i]
+		if !bytes.Equal(g.MQTT, w.MQTT) || !bytes.Equal(g.Context, w.Context) {
+			return false
+		}
+
+		g.MQTT, w.MQTT, g.Context, w.Context = nil, nil, nil, nil
+		if !reflect.DeepEqual(g, w) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func filesEqual(got, want database.File) bool {
+	if !timesEqual(&got.AddedAt, &want.AddedAt) || !timesEqual(got.ProcessedAt, want.ProcessedAt) {
+		return false
+	}
+
+	got.AddedAt, want.AddedAt = time.Time{}, time.Time{}
+	got.ProcessedAt, want.ProcessedAt = nil, nil
+
+	return got == want
+}
+
+func timesEqual(got, want *time.Time) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+
+	diff := got.Sub(*want)
+	return diff < timePrecision && diff > -timePrecision
+}
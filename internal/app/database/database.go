@@ -2,8 +2,12 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/config"
 )
 
 type Record struct {
@@ -24,13 +28,168 @@ type Record struct {
 	InvertBit int
 }
 
+const (
+	FileQueued     = "queued"
+	FileProcessing = "processing"
+	FileProcessed  = "processed"
+	FileFailed     = "failed"
+)
+
+// File is an entry of the ingestion ledger
+type File struct {
+	Name         string
+	Status       string
+	RowsTotal    int
+	RowsParsed   int
+	RowsRejected int
+	Error        string
+	AddedAt      time.Time
+	ProcessedAt  *time.Time
+}
+
+// FileError is a rejected line of a file, Line is 1-based
+type FileError struct {
+	Line  int
+	Error string
+}
+
+type FilesFilter struct {
+	Status string
+	Name   string
+	Offset int32
+	Limit  int32
+}
+
+// RecordsFilter narrows records of a unit, empty fields do not filter
+type RecordsFilter struct {
+	Classes []string
+	Levels  []int
+	// From and To bound ingestion time, To is exclusive
+	From time.Time
+	To   time.Time
+}
+
+// UnitsFilter limits units to those whose invid or guid matches any of the glob patterns,
+// only * and ? wildcards are supported. A nil filter matches all units
+type UnitsFilter struct {
+	InvIds    []string
+	UnitGuids []string
+}
+
+// MatchGlob reports whether value matches the pattern of UnitsFilter like queries of databases do:
+// * matches any sequence of characters including /, ? matches one character
+func MatchGlob(pattern string, value string) bool {
+	p, v := []rune(pattern), []rune(value)
+
+	// star is the position of the last * in pattern, matched is where the value part it matches ends
+	i, j := 0, 0
+	star, matched := -1, 0
+	for j < len(v) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, matched = i, j
+			i++
+		case i < len(p) && (p[i] == '?' || p[i] == v[j]):
+			i++
+			j++
+		case star >= 0:
+			// the last * takes one more character
+			matched++
+			i, j = star+1, matched
+		default:
+			return false
+		}
+	}
+
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+
+	return i == len(p)
+}
+
+// Count is a number of records with the value of a column
+type Count struct {
+	Value   string
+	Records int64
+}
+
+// UnitStats are aggregates of records of a unit, counts are ordered by value
+type UnitStats struct {
+	Records int64
+	// MsgIds is a number of distinct msg_id
+	MsgIds  int64
+	Classes []Count
+	Levels  []Count
+	Areas   []Count
+}
+
+// Unit is a device found in the data with number of its records
+type Unit struct {
+	Guid      uuid.UUID
+	InvId     string
+	Records   int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
 type IDatabase interface {
+	Ping(ctx context.Context) error
+
 	AddProcessedFile(ctx context.Context, filename string) error
 
 	GetProcessedFiles(ctx context.Context) ([]string, error)
+	UpdateFile(ctx context.Context, file File) error
+	AddFileErrors(ctx context.Context, filename string, fileErrors []FileError) error
+	ListFiles(ctx context.Context, filter FilesFilter) ([]File, error)
+	GetFile(ctx context.Context, filename string) (*File, []FileError, error)
+	// ClearFileData removes records and errors of the file and puts it back to queued state
+	ClearFileData(ctx context.Context, filename string) error
 
-	AddDataRow(ctx context.Context, data []Record) error
+	AddDataRow(ctx context.Context, filename string, data []Record) error
 	GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Record, error)
+	// GetRecordsByFilter returns records of the guid matching the filter in order of ingestion
+	GetRecordsByFilter(ctx context.Context, guid uuid.UUID, filter RecordsFilter) ([]Record, error)
 
 	GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32, limit int32) ([]Record, error)
+	GetUnits(ctx context.Context, filter *UnitsFilter, offset int32, limit int32) ([]Unit, error)
+	// GetUnitStats aggregates records of the guid matching the filter
+	GetUnitStats(ctx context.Context, guid uuid.UUID, filter RecordsFilter) (*UnitStats, error)
+	// GetUnit returns nil if the unit is unknown
+	GetUnit(ctx context.Context, guid uuid.UUID) (*Unit, error)
+	// GetUnitFiles returns names of files with records of the guid in order of ingestion
+	GetUnitFiles(ctx context.Context, guid uuid.UUID) ([]string, error)
+	// GetClassCounts returns numbers of records of the class by unit_guid, units without them are absent
+	GetClassCounts(ctx context.Context, class string) (map[uuid.UUID]int64, error)
+	// StreamRecordsByGuids reads records of guids by batches of batchSize and passes every batch to fn
+	StreamRecordsByGuids(ctx context.Context, guids []uuid.UUID, batchSize int32, fn func([]Record) error) error
+}
+
+// Migrator is implemented by databases with embedded schema migrations
+type Migrator interface {
+	MigrateUp(ctx context.Context) error
+	MigrateDown(ctx context.Context, steps int) error
+	MigrationsStatus(ctx context.Context) ([]MigrationStatus, error)
+}
+
+// Open connects to the database of the configured driver
+func Open(cfg *config.DB, ctx context.Context) (IDatabase, error) {
+	switch cfg.Driver {
+	case "", "postgres":
+		db, err := New(cfg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case "memory":
+		return NewMemory(), nil
+	case "sqlite":
+		db, err := NewSQLite(cfg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, errors.Errorf("unknown database driver: %s", cfg.Driver)
+	}
 }
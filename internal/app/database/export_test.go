@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// OpenTestPostgres migrates a new schema of the database and connects to it, the schema
+// is dropped when the test ends, so that tests never touch tables of other schemas
+func OpenTestPostgres(ctx context.Context, t *testing.T, dsn string) (*Postgres, error) {
+	admin, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(admin.Close)
+
+	schema := "test_" + strings.ToLower(strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()))
+	_, err = admin.Exec(ctx, fmt.Sprintf(`DROP SCHEMA IF EXISTS %[1]q CASCADE; CREATE SCHEMA %[1]q;`, schema))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), fmt.Sprintf(`DROP SCHEMA IF EXISTS %q CASCADE;`, schema))
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	conn, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(conn.Close)
+
+	db := &Postgres{conn: conn}
+
+	return db, db.MigrateUp(ctx)
+}
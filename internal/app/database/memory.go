@@ -0,0 +1,598 @@
+package database
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// memoryRecord is a stored record with columns which are not part of Record
+type memoryRecord struct {
+	Record
+	file       string
+	ingestedAt time.Time
+}
+
+// Memory keeps everything in process memory for tests and dry runs, data is lost on exit.
+// Ordering and pagination follow Postgres: records in ingestion order, units by guid,
+// files by added time from newest
+type Memory struct {
+	mu sync.RWMutex
+
+	files      map[string]*File
+	fileErrors map[string][]FileError
+	units      map[uuid.UUID]*Unit
+	data       []memoryRecord
+}
+
+func NewMemory() *Memory {
+	db := &Memory{}
+
+	db.files = make(map[string]*File)
+	db.fileErrors = make(map[string][]FileError)
+	db.units = make(map[uuid.UUID]*Unit)
+
+	return db
+}
+
+func (db *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (db *Memory) AddProcessedFile(ctx context.Context, filename string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.files[filename]; ok {
+		return errors.Errorf("file %s already exists", filename)
+	}
+
+	db.files[filename] = &File{Name: filename, Status: FileQueued, AddedAt: time.Now()}
+
+	return nil
+}
+
+func (db *Memory) GetProcessedFiles(ctx context.Context) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var files []string
+	for name := range db.files {
+		files = append(files, name)
+	}
+
+	return files, nil
+}
+
+func (db *Memory) UpdateFile(ctx context.Context, file File) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.files[file.Name]
+	if !ok {
+		return nil
+	}
+
+	stored.Status = file.Status
+	stored.RowsTotal = file.RowsTotal
+	stored.RowsParsed = file.RowsParsed
+	stored.RowsRejected = file.RowsRejected
+	stored.Error = file.Error
+	stored.ProcessedAt = copyTime(file.ProcessedAt)
+
+	return nil
+}
+
+func (db *Memory) AddFileErrors(ctx context.Context, filename string, fileErrors []FileError) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.files[filename]; !ok && len(fileErrors) > 0 {
+		return errors.Errorf("file %s does not exist", filename)
+	}
+
+	db.fileErrors[filename] = append(db.fileErrors[filename], fileErrors...)
+
+	return nil
+}
+
+func (db *Memory) ListFiles(ctx context.Context, filter FilesFilter) ([]File, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var files []File
+	for _, file := range db.files {
+		if filter.Status != "" && file.Status != filter.Status {
+			continue
+		}
+		if filter.Name != "" && !strings.Contains(file.Name, filter.Name) {
+			continue
+		}
+
+		files = append(files, copyFile(file))
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].AddedAt.Equal(files[j].AddedAt) {
+			return files[i].AddedAt.After(files[j].AddedAt)
+		}
+		return files[i].Name < files[j].Name
+	})
+
+	start, end := pageBounds(len(files), filter.Offset, filter.Limit)
+
+	return files[start:end], nil
+}
+
+func (db *Memory) GetFile(ctx context.Context, filename string) (*File, []FileError, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stored, ok := db.files[filename]
+	if !ok {
+		return nil, nil, nil
+	}
+	file := copyFile(stored)
+
+	fileErrors := append([]FileError(nil), db.fileErrors[filename]...)
+	sort.SliceStable(fileErrors, func(i, j int) bool {
+		return fileErrors[i].Line < fileErrors[j].Line
+	})
+
+	return &file, fileErrors, nil
+}
+
+func (db *Memory) ClearFileData(ctx context.Context, filename string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	data := db.data[:0]
+	for _, record := range db.data {
+		if record.file != filename {
+			data = append(data, record)
+		}
+	}
+	db.data = data
+
+	delete(db.fileErrors, filename)
+
+	if file, ok := db.files[filename]; ok {
+		*file = File{Name: file.Name, Status: FileQueued, AddedAt: file.AddedAt}
+	}
+
+	return nil
+}
+
+func (db *Memory) AddDataRow(ctx context.Context, filename string, data []Record) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.files[filename]; !ok && len(data) > 0 {
+		return errors.Errorf("file %s does not exist", filename)
+	}
+
+	now := time.Now()
+
+	for _, row := range data {
+		unit, ok := db.units[row.UnitGuid]
+		if !ok {
+			db.units[row.UnitGuid] = &Unit{Guid: row.UnitGuid, InvId: row.InvId, FirstSeen: now, LastSeen: now}
+			continue
+		}
+
+		unit.InvId = row.InvId
+		unit.LastSeen = now
+	}
+
+	for _, row := range data {
+		db.data = append(db.data, memoryRecord{Record: row, file: filename, ingestedAt: now})
+	}
+
+	return nil
+}
+
+func (db *Memory) GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.records(guid), nil
+}
+
+func (db *Memory) GetRecordsByFilter(ctx context.Context, guid uuid.UUID, filter RecordsFilter) ([]Record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var records []Record
+	for _, record := range db.data {
+		if record.UnitGuid == guid && matchesFilter(record, filter) {
+			records = append(records, db.withInvId(record.Record))
+		}
+	}
+
+	return records, nil
+}
+
+func (db *Memory) GetUnitStats(ctx context.Context, guid uuid.UUID, filter RecordsFilter) (*UnitStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	classes := make(map[string]int64)
+	levels := make(map[int]int64)
+	areas := make(map[string]int64)
+	msgIds := make(map[string]bool)
+
+	stats := &UnitStats{}
+	for _, record := range db.data {
+		if record.UnitGuid != guid || !matchesFilter(record, filter) {
+			continue
+		}
+
+		stats.Records++
+		classes[record.Class]++
+		levels[record.Level]++
+		areas[record.Area]++
+		msgIds[record.MsgId] = true
+	}
+
+	stats.MsgIds = int64(len(msgIds))
+	stats.Classes = sortedCounts(classes)
+	stats.Areas = sortedCounts(areas)
+
+	// levels are ordered as numbers, not as text
+	var values []int
+	for level := range levels {
+		values = append(values, level)
+	}
+	sort.Ints(values)
+	for _, level := range values {
+		stats.Levels = append(stats.Levels, Count{Value: strconv.Itoa(level), Records: levels[level]})
+	}
+
+	return stats, nil
+}
+
+func sortedCounts(counts map[string]int64) []Count {
+	var sorted []Count
+	for value, records := range counts {
+		sorted = append(sorted, Count{Value: value, Records: records})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Value < sorted[j].Value
+	})
+
+	return sorted
+}
+
+func matchesFilter(record memoryRecord, filter RecordsFilter) bool {
+	if len(filter.Classes) > 0 && !containsString(filter.Classes, record.Class) {
+		return false
+	}
+
+	if len(filter.Levels) > 0 {
+		found := false
+		for _, level := range filter.Levels {
+			if level == record.Level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !filter.From.IsZero() && record.ingestedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !record.ingestedAt.Before(filter.To) {
+		return false
+	}
+
+	return true
+}
+
+func matchesUnits(filter *UnitsFilter, unit *Unit) bool {
+	if filter == nil {
+		return true
+	}
+
+	return matchesGlob(filter.InvIds, unit.InvId) || matchesGlob(filter.UnitGuids, unit.Guid.String())
+}
+
+func matchesGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (db *Memory) GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32, limit int32) ([]Record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	records := db.records(guid)
+	start, end := pageBounds(len(records), offset, limit)
+
+	return records[start:end], nil
+}
+
+// records returns records of the guid with invid taken from units like the join of Postgres does
+func (db *Memory) records(guid uuid.UUID) []Record {
+	var records []Record
+	for _, record := range db.data {
+		if record.UnitGuid == guid {
+			records = append(records, db.withInvId(record.Record))
+		}
+	}
+
+	return records
+}
+
+func (db *Memory) withInvId(record Record) Record {
+	if unit, ok := db.units[record.UnitGuid]; ok {
+		record.InvId = unit.InvId
+	}
+
+	return record
+}
+
+func (db *Memory) GetUnits(ctx context.Context, filter *UnitsFilter, offset int32, limit int32) ([]Unit, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	counts := db.recordCounts()
+
+	units := make([]Unit, 0, len(db.units))
+	for _, unit := range db.units {
+		if !matchesUnits(filter, unit) {
+			continue
+		}
+
+		u := *unit
+		u.Records = counts[u.Guid]
+		units = append(units, u)
+	}
+
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].Guid.String() < units[j].Guid.String()
+	})
+
+	start, end := pageBounds(len(units), offset, limit)
+
+	return units[start:end], nil
+}
+
+func (db *Memory) GetUnit(ctx context.Context, guid uuid.UUID) (*Unit, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	unit, ok := db.units[guid]
+	if !ok {
+		return nil, nil
+	}
+
+	u := *unit
+	u.Records = db.recordCounts()[guid]
+
+	return &u, nil
+}
+
+func (db *Memory) recordCounts() map[uuid.UUID]int64 {
+	counts := make(map[uuid.UUID]int64)
+	for _, record := range db.data {
+		counts[record.UnitGuid]++
+	}
+
+	return counts
+}
+
+func (db *Memory) GetUnitFiles(ctx context.Context, guid uuid.UUID) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	seen := make(map[string]bool)
+
+	var files []string
+	for _, record := range db.data {
+		if record.UnitGuid != guid || seen[record.file] {
+			continue
+		}
+		seen[record.file] = true
+
+		files = append(files, record.file)
+	}
+
+	return files, nil
+}
+
+func (db *Memory) GetClassCounts(ctx context.Context, class string) (map[uuid.UUID]int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	counts := make(map[uuid.UUID]int64)
+	for _, record := range db.data {
+		if record.Class == class {
+			counts[record.UnitGuid]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (db *Memory) StreamRecordsByGuids(ctx context.Context, guids []uuid.UUID, batchSize int32, fn func([]Record) error) error {
+	if batchSize < 1 {
+		return errors.New("batch size must be positive")
+	}
+
+	wanted := make(map[uuid.UUID]bool)
+	for _, guid := range guids {
+		wanted[guid] = true
+	}
+
+	// lock is not held while fn runs, so records are taken as they are at the start
+	db.mu.RLock()
+	var records []Record
+	for _, record := range db.data {
+		if wanted[record.UnitGuid] {
+			records = append(records, db.withInvId(record.Record))
+		}
+	}
+	db.mu.RUnlock()
+
+	for start := 0; start < len(records); start += int(batchSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + int(batchSize)
+		if end > len(records) {
+			end = len(records)
+		}
+
+		err := fn(records[start:end:end])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreatePartitions does nothing, months of memory data are only ranges of ingestion time
+func (db *Memory) CreatePartitions(ctx context.Context, from time.Time, months int) error {
+	return nil
+}
+
+func (db *Memory) ListPartitions(ctx context.Context) ([]Partition, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	months := make(map[time.Time]bool)
+	for _, record := range db.data {
+		months[MonthStart(record.ingestedAt)] = true
+	}
+
+	var partitions []Partition
+	for month := range months {
+		partitions = append(partitions, Partition{Name: partitionName(month), From: month, To: month.AddDate(0, 1, 0)})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].From.Before(partitions[j].From)
+	})
+
+	return partitions, nil
+}
+
+func (db *Memory) ArchivePartition(ctx context.Context, name string, w io.Writer) error {
+	from, err := partitionMonth(name)
+	if err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	out := csv.NewWriter(w)
+	out.Comma = '\t'
+
+	err = out.Write(archiveHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range db.data {
+		if !inMonth(record.ingestedAt, from) {
+			continue
+		}
+
+		r := db.withInvId(record.Record)
+		err = out.Write([]string{strconv.Itoa(r.N), byteaText(r.MQTT), r.InvId, r.UnitGuid.String(), r.MsgId,
+			r.Text, byteaText(r.Context), r.Class, strconv.Itoa(r.Level), r.Area, r.Addr, r.Block, r.Type,
+			strconv.Itoa(r.Bit), strconv.Itoa(r.InvertBit), record.file,
+			record.ingestedAt.UTC().Format(sqliteTimeFormat)})
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+func (db *Memory) DropPartition(ctx context.Context, name string) error {
+	from, err := partitionMonth(name)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	data := db.data[:0]
+	for _, record := range db.data {
+		if !inMonth(record.ingestedAt, from) {
+			data = append(data, record)
+		}
+	}
+	db.data = data
+
+	return nil
+}
+
+func inMonth(t time.Time, month time.Time) bool {
+	return !t.Before(month) && t.Before(month.AddDate(0, 1, 0))
+}
+
+// pageBounds returns slice bounds of the page like LIMIT and OFFSET do
+func pageBounds(length int, offset int32, limit int32) (int, int) {
+	if offset < 0 || int(offset) >= length || limit <= 0 {
+		return 0, 0
+	}
+
+	end := int(offset) + int(limit)
+	if end > length {
+		end = length
+	}
+
+	return int(offset), end
+}
+
+func copyFile(file *File) File {
+	f := *file
+	f.ProcessedAt = copyTime(file.ProcessedAt)
+
+	return f
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	c := *t
+	return &c
+}
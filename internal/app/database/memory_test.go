@@ -0,0 +1,13 @@
+package database_test
+
+import (
+	"testing"
+
+	"test_task/internal/app/database"
+)
+
+func TestMemory(t *testing.T) {
+	runConformance(t, func(t *testing.T) database.IDatabase {
+		return database.NewMemory()
+	})
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// migrationsLockID is a key of the advisory lock which keeps several
+// instances from migrating the same database at once
+const migrationsLockID = 5300
+
+// migrationsFS keeps migrations of every driver in its own directory
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationsFS embed.FS
+
+// Migration is a versioned schema change, files are named <version>_<name>.<up|down>.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("migration file %s has no version", name)
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, errors.Errorf("migration file %s has invalid version", name)
+		}
+
+		sql, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies all migrations which are not in schema_migrations yet
+func (db *Postgres) MigrateUp(ctx context.Context) error {
+	return db.withMigrationsLock(ctx, func(conn *pgx.Conn, migrations []Migration, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+
+			err := applyMigration(ctx, conn, m.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`, m.Version, m.Name)
+			if err != nil {
+				return errors.Wrapf(err, "apply migration %d_%s", m.Version, m.Name)
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back last steps applied migrations
+func (db *Postgres) MigrateDown(ctx context.Context, steps int) error {
+	return db.withMigrationsLock(ctx, func(conn *pgx.Conn, migrations []Migration, applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return errors.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+			}
+
+			err := applyMigration(ctx, conn, m.Down,
+				`DELETE FROM schema_migrations WHERE version = $1;`, m.Version)
+			if err != nil {
+				return errors.Wrapf(err, "roll back migration %d_%s", m.Version, m.Name)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+func (db *Postgres) MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := db.withMigrationsLock(ctx, func(conn *pgx.Conn, migrations []Migration, applied map[int]time.Time) error {
+		for _, m := range migrations {
+			status := MigrationStatus{Migration: m}
+			if appliedAt, ok := applied[m.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (db *Postgres) withMigrationsLock(ctx context.Context,
+	fn func(conn *pgx.Conn, migrations []Migration, applied map[int]time.Time) error) error {
+	migrations, err := loadMigrations(migrationsFS, "migrations/postgres")
+	if err != nil {
+		return err
+	}
+
+	poolConn, err := db.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer poolConn.Release()
+	conn := poolConn.Conn()
+
+	_, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1);`, migrationsLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationsLockID)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version int PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	);`)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, migrations, applied)
+}
+
+func appliedMigrations(ctx context.Context, conn *pgx.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// applyMigration runs migration script and records it in schema_migrations in one transaction
+func applyMigration(ctx context.Context, conn *pgx.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// MigrateUp applies all migrations which are not in schema_migrations yet
+func (db *SQLite) MigrateUp(ctx context.Context) error {
+	migrations, applied, err := db.loadMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err = db.applyMigration(ctx, m.Up,
+			`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?);`,
+			m.Version, m.Name, time.Now().UTC())
+		if err != nil {
+			return errors.Wrapf(err, "apply migration %d_%s", m.Version, m.Name)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back last steps applied migrations
+func (db *SQLite) MigrateDown(ctx context.Context, steps int) error {
+	migrations, applied, err := db.loadMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return errors.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+
+		err = db.applyMigration(ctx, m.Down, `DELETE FROM schema_migrations WHERE version = ?;`, m.Version)
+		if err != nil {
+			return errors.Wrapf(err, "roll back migration %d_%s", m.Version, m.Name)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+func (db *SQLite) MigrationsStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, applied, err := db.loadMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (db *SQLite) loadMigrations(ctx context.Context) ([]Migration, map[int]time.Time, error) {
+	migrations, err := loadMigrations(migrationsFS, "migrations/sqlite")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = db.conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	);`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return migrations, applied, rows.Err()
+}
+
+// applyMigration runs migration script and records it in schema_migrations in one transaction
+func (db *SQLite) applyMigration(ctx context.Context, script string, record string, args ...interface{}) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
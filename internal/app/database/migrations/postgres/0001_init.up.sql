@@ -18,4 +18,4 @@ CREATE TABLE IF NOT EXISTS data (
     type text,
     bit int,
     invert_bit int
-);
\ No newline at end of file
+);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS data_file_idx;
+
+ALTER TABLE data DROP COLUMN IF EXISTS file;
+
+DROP TABLE IF EXISTS file_errors;
+
+ALTER TABLE files
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS rows_total,
+    DROP COLUMN IF EXISTS rows_parsed,
+    DROP COLUMN IF EXISTS rows_rejected,
+    DROP COLUMN IF EXISTS error,
+    DROP COLUMN IF EXISTS added_at,
+    DROP COLUMN IF EXISTS processed_at;
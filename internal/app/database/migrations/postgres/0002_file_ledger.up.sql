@@ -0,0 +1,18 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'queued',
+    ADD COLUMN IF NOT EXISTS rows_total int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rows_parsed int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rows_rejected int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS error text,
+    ADD COLUMN IF NOT EXISTS added_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS processed_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS file_errors(
+    file text NOT NULL REFERENCES files(file) ON DELETE CASCADE,
+    line int NOT NULL,
+    error text NOT NULL
+);
+
+ALTER TABLE data ADD COLUMN IF NOT EXISTS file text;
+
+CREATE INDEX IF NOT EXISTS data_file_idx ON data (file);
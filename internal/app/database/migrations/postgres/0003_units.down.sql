@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS data_unit_guid_idx;
+
+ALTER TABLE data
+    DROP CONSTRAINT IF EXISTS data_file_fkey,
+    DROP CONSTRAINT IF EXISTS data_unit_guid_fkey,
+    ADD COLUMN invid text;
+
+UPDATE data SET invid = units.invid FROM units WHERE data.unit_guid = units.unit_guid;
+
+ALTER TABLE data ALTER COLUMN invid SET NOT NULL;
+
+DROP TABLE IF EXISTS units;
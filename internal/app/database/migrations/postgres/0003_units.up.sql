@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS units(
+    unit_guid uuid PRIMARY KEY,
+    invid text NOT NULL,
+    first_seen timestamptz NOT NULL DEFAULT now(),
+    last_seen timestamptz NOT NULL DEFAULT now()
+);
+
+INSERT INTO units (unit_guid, invid)
+    SELECT unit_guid, min(invid) FROM data GROUP BY unit_guid
+    ON CONFLICT (unit_guid) DO NOTHING;
+
+ALTER TABLE data
+    DROP COLUMN invid,
+    ADD CONSTRAINT data_unit_guid_fkey FOREIGN KEY (unit_guid) REFERENCES units(unit_guid),
+    ADD CONSTRAINT data_file_fkey FOREIGN KEY (file) REFERENCES files(file) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS data_unit_guid_idx ON data (unit_guid);
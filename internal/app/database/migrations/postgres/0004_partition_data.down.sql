@@ -0,0 +1,28 @@
+CREATE TABLE data_unpartitioned (
+    n int NOT NULL,
+    mqtt bytea,
+    unit_guid uuid NOT NULL REFERENCES units(unit_guid),
+    msg_id text NOT NULL,
+    text text NOT NULL,
+    context bytea,
+    class text NOT NULL,
+    level int NOT NULL,
+    area text NOT NULL,
+    addr text NOT NULL,
+    block text,
+    type text,
+    bit int,
+    invert_bit int,
+    file text REFERENCES files(file) ON DELETE CASCADE
+);
+
+INSERT INTO data_unpartitioned
+    SELECT n, mqtt, unit_guid, msg_id, text, context, class, level, area, addr, block, type, bit, invert_bit, file
+    FROM data;
+
+DROP TABLE data;
+
+ALTER TABLE data_unpartitioned RENAME TO data;
+
+CREATE INDEX data_file_idx ON data (file);
+CREATE INDEX data_unit_guid_idx ON data (unit_guid);
@@ -0,0 +1,42 @@
+ALTER TABLE data RENAME TO data_unpartitioned;
+
+DROP INDEX IF EXISTS data_file_idx;
+DROP INDEX IF EXISTS data_unit_guid_idx;
+
+CREATE TABLE data (
+    n int NOT NULL,
+    mqtt bytea,
+    unit_guid uuid NOT NULL REFERENCES units(unit_guid),
+    msg_id text NOT NULL,
+    text text NOT NULL,
+    context bytea,
+    class text NOT NULL,
+    level int NOT NULL,
+    area text NOT NULL,
+    addr text NOT NULL,
+    block text,
+    type text,
+    bit int,
+    invert_bit int,
+    file text REFERENCES files(file) ON DELETE CASCADE,
+    ingested_at timestamptz NOT NULL DEFAULT now()
+) PARTITION BY RANGE (ingested_at);
+
+CREATE INDEX data_file_idx ON data (file);
+CREATE INDEX data_unit_guid_idx ON data (unit_guid);
+
+-- partitions are monthly in UTC, next ones are created by the service
+DO $$
+DECLARE
+    month_start timestamp := date_trunc('month', now() AT TIME ZONE 'UTC');
+BEGIN
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF data FOR VALUES FROM (%L) TO (%L)',
+        'data_' || to_char(month_start, 'YYYY_MM'),
+        month_start AT TIME ZONE 'UTC', (month_start + interval '1 month') AT TIME ZONE 'UTC');
+END $$;
+
+INSERT INTO data (n, mqtt, unit_guid, msg_id, text, context, class, level, area, addr, block, type, bit, invert_bit, file)
+    SELECT n, mqtt, unit_guid, msg_id, text, context, class, level, area, addr, block, type, bit, invert_bit, file
+    FROM data_unpartitioned;
+
+DROP TABLE data_unpartitioned;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS data_unit_guid_id_idx;
+CREATE INDEX IF NOT EXISTS data_unit_guid_idx ON data (unit_guid);
+
+ALTER TABLE data DROP COLUMN IF EXISTS id;
@@ -0,0 +1,5 @@
+-- id keeps records in ingestion order for stable pagination
+ALTER TABLE data ADD COLUMN IF NOT EXISTS id bigserial;
+
+DROP INDEX IF EXISTS data_unit_guid_idx;
+CREATE INDEX IF NOT EXISTS data_unit_guid_id_idx ON data (unit_guid, id);
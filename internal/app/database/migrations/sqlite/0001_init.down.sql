@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS data;
+DROP TABLE IF EXISTS units;
+DROP TABLE IF EXISTS file_errors;
+DROP TABLE IF EXISTS files;
@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS files(
+    file TEXT PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'queued',
+    rows_total INTEGER NOT NULL DEFAULT 0,
+    rows_parsed INTEGER NOT NULL DEFAULT 0,
+    rows_rejected INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    added_at DATETIME NOT NULL,
+    processed_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS file_errors(
+    file TEXT NOT NULL REFERENCES files(file) ON DELETE CASCADE,
+    line INTEGER NOT NULL,
+    error TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS units(
+    unit_guid TEXT PRIMARY KEY,
+    invid TEXT NOT NULL,
+    first_seen DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS data (
+    n INTEGER NOT NULL,
+    mqtt BLOB,
+    unit_guid TEXT NOT NULL REFERENCES units(unit_guid),
+    msg_id TEXT NOT NULL,
+    text TEXT NOT NULL,
+    context BLOB,
+    class TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    area TEXT NOT NULL,
+    addr TEXT NOT NULL,
+    block TEXT,
+    type TEXT,
+    bit INTEGER,
+    invert_bit INTEGER,
+    file TEXT REFERENCES files(file) ON DELETE CASCADE,
+    ingested_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS data_file_idx ON data (file);
+CREATE INDEX IF NOT EXISTS data_unit_guid_idx ON data (unit_guid);
+CREATE INDEX IF NOT EXISTS data_ingested_at_idx ON data (ingested_at);
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const partitionPrefix = "data_"
+
+// Partition is a monthly partition of data table, bounds are in UTC
+type Partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// MonthStart returns the first moment of the UTC month of t
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(month time.Time) string {
+	return partitionPrefix + month.Format("2006_01")
+}
+
+// CreatePartitions makes partitions for months number of months starting from the month of from
+func (db *Postgres) CreatePartitions(ctx context.Context, from time.Time, months int) error {
+	start := MonthStart(from)
+
+	for i := 0; i < months; i++ {
+		month := start.AddDate(0, i, 0)
+		_, err := db.conn.Exec(ctx, fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF data FOR VALUES FROM ('%s') TO ('%s');`,
+			pgx.Identifier{partitionName(month)}.Sanitize(),
+			month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListPartitions returns partitions of data table created by the service ordered by month
+func (db *Postgres) ListPartitions(ctx context.Context) ([]Partition, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = 'data'::regclass ORDER BY c.relname;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		month, err := time.Parse("2006_01", strings.TrimPrefix(name, partitionPrefix))
+		if err != nil {
+			// partition is not managed by the service
+			continue
+		}
+
+		partitions = append(partitions, Partition{Name: name, From: month, To: month.AddDate(0, 1, 0)})
+	}
+
+	return partitions, rows.Err()
+}
+
+// ArchivePartition writes records of the partition to w as TSV with a header line
+func (db *Postgres) ArchivePartition(ctx context.Context, name string, w io.Writer) error {
+	conn, err := db.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Conn().PgConn().CopyTo(ctx, w, fmt.Sprintf(
+		`COPY (SELECT `+recordColumns+`, d.file, d.ingested_at FROM %s d JOIN units u ON u.unit_guid = d.unit_guid
+			ORDER BY d.id) TO STDOUT WITH (FORMAT csv, DELIMITER E'\t', HEADER);`,
+		pgx.Identifier{name}.Sanitize()))
+
+	return err
+}
+
+func (db *Postgres) DropPartition(ctx context.Context, name string) error {
+	_, err := db.conn.Exec(ctx, `DROP TABLE `+pgx.Identifier{name}.Sanitize()+`;`)
+
+	return err
+}
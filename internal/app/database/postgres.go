@@ -3,14 +3,40 @@ package database
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
 
 	"test_task/internal/app/config"
 )
 
+const (
+	recordColumns = `d.n, d.mqtt, u.invid, d.unit_guid, d.msg_id, d.text, d.context, d.class, d.level, d.area, d.addr,
+		d.block, d.type, d.bit, d.invert_bit`
+	// records keep only unit_guid, invid is taken from units
+	recordsTable = `data d JOIN units u ON u.unit_guid = d.unit_guid`
+	// recordsFilter selects data d of RecordsFilter passed by recordsFilterArgs
+	recordsFilter = `d.unit_guid=$1
+		AND (coalesce(cardinality($2::text[]), 0) = 0 OR d.class = ANY($2))
+		AND (coalesce(cardinality($3::int[]), 0) = 0 OR d.level = ANY($3))
+		AND ($4::timestamptz IS NULL OR d.ingested_at >= $4)
+		AND ($5::timestamptz IS NULL OR d.ingested_at < $5)`
+	fileColumns = `file, status, rows_total, rows_parsed, rows_rejected, COALESCE(error, ''), added_at, processed_at`
+	unitColumns = `u.unit_guid, u.invid, u.first_seen, u.last_seen`
+)
+
+var tracer = otel.Tracer("test_task/internal/app/database")
+
+// rowScanner is a current row of pgx or database/sql rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type Postgres struct {
 	conn *pgxpool.Pool
 }
@@ -27,9 +53,20 @@ func New(cfg *config.DB, ctx context.Context) (*Postgres, error) {
 	db := Postgres{}
 	db.conn = conn
 
+	if cfg.AutoMigrate {
+		err = db.MigrateUp(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &db, nil
 }
 
+func (db *Postgres) Ping(ctx context.Context) error {
+	return db.conn.Ping(ctx)
+}
+
 func (db *Postgres) AddProcessedFile(ctx context.Context, filename string) error {
 	rows, err := db.conn.Query(ctx,
 		`INSERT INTO files VALUES ($1);`, filename)
@@ -43,7 +80,7 @@ func (db *Postgres) AddProcessedFile(ctx context.Context, filename string) error
 
 func (db *Postgres) GetProcessedFiles(ctx context.Context) ([]string, error) {
 	rows, err := db.conn.Query(ctx,
-		`SELECT * FROM files;`)
+		`SELECT file FROM files;`)
 	defer rows.Close()
 	if err != nil {
 		return nil, err
@@ -64,34 +101,172 @@ func (db *Postgres) GetProcessedFiles(ctx context.Context) ([]string, error) {
 	return files, nil
 }
 
-func (db *Postgres) AddDataRow(ctx context.Context, data []Record) error {
+func (db *Postgres) UpdateFile(ctx context.Context, file File) error {
+	_, err := db.conn.Exec(ctx,
+		`UPDATE files SET status=$2, rows_total=$3, rows_parsed=$4, rows_rejected=$5, error=NULLIF($6, ''),
+			processed_at=$7 WHERE file=$1;`,
+		file.Name, file.Status, file.RowsTotal, file.RowsParsed, file.RowsRejected, file.Error, file.ProcessedAt)
+
+	return err
+}
+
+func (db *Postgres) AddFileErrors(ctx context.Context, filename string, fileErrors []FileError) error {
+	batch := &pgx.Batch{}
+
+	for _, fileError := range fileErrors {
+		batch.Queue(`INSERT INTO file_errors VALUES ($1, $2, $3);`, filename, fileError.Line, fileError.Error)
+	}
+
+	return db.conn.SendBatch(ctx, batch).Close()
+}
+
+func (db *Postgres) ListFiles(ctx context.Context, filter FilesFilter) ([]File, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+fileColumns+` FROM files
+			WHERE ($1 = '' OR status = $1) AND ($2 = '' OR strpos(file, $2) > 0)
+			ORDER BY added_at DESC, file LIMIT $3 OFFSET $4;`,
+		filter.Status, filter.Name, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (db *Postgres) GetFile(ctx context.Context, filename string) (*File, []FileError, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+fileColumns+` FROM files WHERE file=$1;`, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil, rows.Err()
+	}
+
+	file, err := scanFile(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	rows, err = db.conn.Query(ctx,
+		`SELECT line, error FROM file_errors WHERE file=$1 ORDER BY line;`, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var fileErrors []FileError
+	for rows.Next() {
+		var fileError FileError
+		err = rows.Scan(&fileError.Line, &fileError.Error)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fileErrors = append(fileErrors, fileError)
+	}
+
+	return &file, fileErrors, rows.Err()
+}
+
+func (db *Postgres) ClearFileData(ctx context.Context, filename string) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM data WHERE file=$1;`, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM file_errors WHERE file=$1;`, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE files SET status=$2, rows_total=0, rows_parsed=0, rows_rejected=0, error=NULL, processed_at=NULL
+			WHERE file=$1;`, filename, FileQueued)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (db *Postgres) AddDataRow(ctx context.Context, filename string, data []Record) error {
+	ctx, span := tracer.Start(ctx, "Postgres.AddDataRow")
+	defer span.End()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	batch := &pgx.Batch{}
 
+	// units have to exist before rows referencing them
+	units := make(map[uuid.UUID]bool)
+	for _, row := range data {
+		if units[row.UnitGuid] {
+			continue
+		}
+		units[row.UnitGuid] = true
+
+		batch.Queue(`INSERT INTO units (unit_guid, invid) VALUES ($1, $2)
+			ON CONFLICT (unit_guid) DO UPDATE SET invid = EXCLUDED.invid, last_seen = now();`,
+			row.UnitGuid, row.InvId)
+	}
+
 	for _, row := range data {
-		batch.Queue(`INSERT INTO data VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`,
-			row.N, row.MQTT, row.InvId, row.UnitGuid, row.MsgId, row.Text, row.Context, row.Class,
-			row.Level, row.Area, row.Addr, row.Block, row.Type, row.Bit, row.InvertBit)
+		batch.Queue(`INSERT INTO data (n, mqtt, unit_guid, msg_id, text, context, class, level, area, addr, block,
+				type, bit, invert_bit, file)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`,
+			row.N, row.MQTT, row.UnitGuid, row.MsgId, row.Text, row.Context, row.Class,
+			row.Level, row.Area, row.Addr, row.Block, row.Type, row.Bit, row.InvertBit, filename)
 	}
 
-	br := db.conn.SendBatch(ctx, batch)
+	br := tx.SendBatch(ctx, batch)
 
-	for _, _ = range data {
+	for i := 0; i < batch.Len(); i++ {
 		_, err := br.Exec()
 		if err != nil {
+			br.Close()
 			return err
 		}
 	}
 
-	err := br.Close()
+	err = br.Close()
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return tx.Commit(ctx)
 }
 
 func (db *Postgres) GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetRecordsByGuid")
+	defer span.End()
+
 	rows, err := db.conn.Query(ctx,
-		`SELECT * FROM data WHERE (unit_guid=$1);`, guid)
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE d.unit_guid=$1 ORDER BY d.id;`, guid)
 	defer rows.Close()
 	if err != nil {
 		return nil, err
@@ -99,23 +274,7 @@ func (db *Postgres) GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Rec
 
 	var allRecords []Record
 	for rows.Next() {
-		var oneRecord Record
-		err = rows.Scan(
-			&oneRecord.N,
-			&oneRecord.MQTT,
-			&oneRecord.InvId,
-			&oneRecord.UnitGuid,
-			&oneRecord.MsgId,
-			&oneRecord.Text,
-			&oneRecord.Context,
-			&oneRecord.Class,
-			&oneRecord.Level,
-			&oneRecord.Area,
-			&oneRecord.Addr,
-			&oneRecord.Block,
-			&oneRecord.Type,
-			&oneRecord.Bit,
-			&oneRecord.InvertBit)
+		oneRecord, err := scanRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -126,9 +285,132 @@ func (db *Postgres) GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Rec
 	return allRecords, nil
 }
 
+// GetFileRecords returns records of the unit added from the file in ingestion order
+func (db *Postgres) GetFileRecords(ctx context.Context, file string, guid uuid.UUID) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetFileRecords")
+	defer span.End()
+
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE d.file=$1 AND d.unit_guid=$2 ORDER BY d.id;`, file, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (db *Postgres) GetRecordsByFilter(ctx context.Context, guid uuid.UUID, filter RecordsFilter) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetRecordsByFilter")
+	defer span.End()
+
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE `+recordsFilter+` ORDER BY d.id;`,
+		recordsFilterArgs(guid, filter)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (db *Postgres) GetUnitStats(ctx context.Context, guid uuid.UUID, filter RecordsFilter) (*UnitStats, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetUnitStats")
+	defer span.End()
+
+	args := recordsFilterArgs(guid, filter)
+	stats := &UnitStats{}
+
+	err := db.conn.QueryRow(ctx,
+		`SELECT count(*), count(DISTINCT d.msg_id) FROM data d WHERE `+recordsFilter+`;`, args...).
+		Scan(&stats.Records, &stats.MsgIds)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Classes, err = db.countBy(ctx, "d.class", args)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Levels, err = db.countBy(ctx, "d.level", args)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Areas, err = db.countBy(ctx, "d.area", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// countBy counts filtered records by values of the column
+func (db *Postgres) countBy(ctx context.Context, column string, args []interface{}) ([]Count, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+column+`::text, count(*) FROM data d WHERE `+recordsFilter+`
+			GROUP BY `+column+` ORDER BY `+column+`;`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []Count
+	for rows.Next() {
+		var count Count
+		err = rows.Scan(&count.Value, &count.Records)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func recordsFilterArgs(guid uuid.UUID, filter RecordsFilter) []interface{} {
+	return []interface{}{guid, filter.Classes, filter.Levels, nullTime(filter.From), nullTime(filter.To)}
+}
+
+// nullTime passes zero time as NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
 func (db *Postgres) GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32, limit int32) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "Postgres.GetDataAPI")
+	defer span.End()
+
 	rows, err := db.conn.Query(ctx,
-		`SELECT * FROM data WHERE unit_guid=$1 LIMIT $2 OFFSET $3;`, guid, limit, offset)
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE d.unit_guid=$1 ORDER BY d.id
+			LIMIT $2 OFFSET $3;`, guid, limit, offset)
 	defer rows.Close()
 	if err != nil {
 		return nil, err
@@ -136,23 +418,7 @@ func (db *Postgres) GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32
 
 	var allRecords []Record
 	for rows.Next() {
-		var oneRecord Record
-		err = rows.Scan(
-			&oneRecord.N,
-			&oneRecord.MQTT,
-			&oneRecord.InvId,
-			&oneRecord.UnitGuid,
-			&oneRecord.MsgId,
-			&oneRecord.Text,
-			&oneRecord.Context,
-			&oneRecord.Class,
-			&oneRecord.Level,
-			&oneRecord.Area,
-			&oneRecord.Addr,
-			&oneRecord.Block,
-			&oneRecord.Type,
-			&oneRecord.Bit,
-			&oneRecord.InvertBit)
+		oneRecord, err := scanRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -162,3 +428,283 @@ func (db *Postgres) GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32
 
 	return allRecords, nil
 }
+
+func (db *Postgres) GetUnits(ctx context.Context, filter *UnitsFilter, offset int32, limit int32) ([]Unit, error) {
+	var invIds, unitGuids []string
+	if filter != nil {
+		invIds = likePatterns(filter.InvIds)
+		unitGuids = likePatterns(filter.UnitGuids)
+	}
+
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+unitColumns+`, (SELECT count(*) FROM data d WHERE d.unit_guid = u.unit_guid)
+			FROM units u
+			WHERE $1 OR u.invid LIKE ANY($2::text[]) OR u.unit_guid::text LIKE ANY($3::text[])
+			ORDER BY u.unit_guid LIMIT $4 OFFSET $5;`,
+		filter == nil, invIds, unitGuids, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []Unit
+	for rows.Next() {
+		unit, err := scanUnit(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		units = append(units, unit)
+	}
+
+	return units, rows.Err()
+}
+
+func (db *Postgres) GetUnit(ctx context.Context, guid uuid.UUID) (*Unit, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+unitColumns+`, (SELECT count(*) FROM data d WHERE d.unit_guid = u.unit_guid)
+			FROM units u WHERE u.unit_guid=$1;`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	unit, err := scanUnit(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unit, nil
+}
+
+func (db *Postgres) GetUnitFiles(ctx context.Context, guid uuid.UUID) ([]string, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT file FROM data WHERE unit_guid=$1 AND file IS NOT NULL GROUP BY file ORDER BY min(id);`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		err = rows.Scan(&file)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (db *Postgres) GetClassCounts(ctx context.Context, class string) (map[uuid.UUID]int64, error) {
+	rows, err := db.conn.Query(ctx,
+		`SELECT unit_guid, count(*) FROM data WHERE class=$1 GROUP BY unit_guid;`, class)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[uuid.UUID]int64)
+	for rows.Next() {
+		var guid uuid.UUID
+		var count int64
+		err = rows.Scan(&guid, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[guid] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (db *Postgres) StreamRecordsByGuids(ctx context.Context, guids []uuid.UUID, batchSize int32, fn func([]Record) error) error {
+	ctx, span := tracer.Start(ctx, "Postgres.StreamRecordsByGuids")
+	defer span.End()
+
+	if batchSize < 1 {
+		return errors.New("batch size must be positive")
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// cursor lives only inside the transaction, rollback closes it
+	defer tx.Rollback(ctx)
+
+	strGuids := make([]string, 0, len(guids))
+	for _, guid := range guids {
+		strGuids = append(strGuids, guid.String())
+	}
+
+	_, err = tx.Exec(ctx,
+		`DECLARE records_cursor NO SCROLL CURSOR FOR SELECT `+recordColumns+` FROM `+recordsTable+`
+			WHERE d.unit_guid = ANY($1::uuid[]) ORDER BY d.id;`,
+		strGuids)
+	if err != nil {
+		return err
+	}
+
+	for {
+		batch, err := fetchRecords(ctx, tx, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		// fn blocks while consumer is busy, so next batch is not fetched until previous one is handled
+		err = fn(batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func fetchRecords(ctx context.Context, tx pgx.Tx, batchSize int32) ([]Record, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`FETCH %d FROM records_cursor;`, batchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []Record
+	for rows.Next() {
+		oneRecord, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, oneRecord)
+	}
+
+	return batch, rows.Err()
+}
+
+func scanRecord(rows rowScanner) (Record, error) {
+	var oneRecord Record
+	err := rows.Scan(
+		&oneRecord.N,
+		&oneRecord.MQTT,
+		&oneRecord.InvId,
+		&oneRecord.UnitGuid,
+		&oneRecord.MsgId,
+		&oneRecord.Text,
+		&oneRecord.Context,
+		&oneRecord.Class,
+		&oneRecord.Level,
+		&oneRecord.Area,
+		&oneRecord.Addr,
+		&oneRecord.Block,
+		&oneRecord.Type,
+		&oneRecord.Bit,
+		&oneRecord.InvertBit)
+
+	return oneRecord, err
+}
+
+func (db *Postgres) Notify(ctx context.Context, channel string, payloads []string) error {
+	batch := &pgx.Batch{}
+
+	for _, payload := range payloads {
+		batch.Queue(`SELECT pg_notify($1, $2);`, channel, payload)
+	}
+
+	br := db.conn.SendBatch(ctx, batch)
+
+	for range payloads {
+		_, err := br.Exec()
+		if err != nil {
+			br.Close()
+			return err
+		}
+	}
+
+	return br.Close()
+}
+
+// Listen holds one connection of the pool until ctx is done or the connection fails
+func (db *Postgres) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := db.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, `LISTEN `+pgx.Identifier{channel}.Sanitize()+`;`)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		fn(notification.Payload)
+	}
+}
+
+func scanFile(rows rowScanner) (File, error) {
+	var file File
+	err := rows.Scan(
+		&file.Name,
+		&file.Status,
+		&file.RowsTotal,
+		&file.RowsParsed,
+		&file.RowsRejected,
+		&file.Error,
+		&file.AddedAt,
+		&file.ProcessedAt)
+
+	return file, err
+}
+
+func scanUnit(rows rowScanner) (Unit, error) {
+	var unit Unit
+	err := rows.Scan(
+		&unit.Guid,
+		&unit.InvId,
+		&unit.FirstSeen,
+		&unit.LastSeen,
+		&unit.Records)
+
+	return unit, err
+}
+
+// likePatterns converts glob patterns of UnitsFilter to LIKE patterns
+func likePatterns(globs []string) []string {
+	patterns := make([]string, 0, len(globs))
+	for _, glob := range globs {
+		var b strings.Builder
+		for _, r := range glob {
+			switch r {
+			case '*':
+				b.WriteByte('%')
+			case '?':
+				b.WriteByte('_')
+			case '%', '_', '\\':
+				b.WriteByte('\\')
+				b.WriteRune(r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		patterns = append(patterns, b.String())
+	}
+
+	return patterns
+}
@@ -0,0 +1,679 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+
+	"test_task/internal/app/config"
+)
+
+// sqliteTimeFormat is how the driver writes times with _time_format=sqlite, all times are stored in UTC
+// so that text comparison of columns matches time order
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+var archiveHeader = []string{"n", "mqtt", "invid", "unit_guid", "msg_id", "text", "context", "class", "level",
+	"area", "addr", "block", "type", "bit", "invert_bit", "file", "ingested_at"}
+
+// SQLite keeps everything in one local file for installations without a Postgres server
+type SQLite struct {
+	conn *sql.DB
+}
+
+func NewSQLite(cfg *config.DB, ctx context.Context) (*SQLite, error) {
+	if cfg.SQLitePath == "" {
+		return nil, errors.New("sqlite database path is not set")
+	}
+
+	dsn := cfg.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)" +
+		"&_time_format=sqlite"
+
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := SQLite{}
+	db.conn = conn
+
+	if cfg.AutoMigrate {
+		err = db.MigrateUp(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &db, nil
+}
+
+func (db *SQLite) Ping(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
+func (db *SQLite) AddProcessedFile(ctx context.Context, filename string) error {
+	_, err := db.conn.ExecContext(ctx,
+		`INSERT INTO files (file, added_at) VALUES (?, ?);`, filename, time.Now().UTC())
+
+	return err
+}
+
+func (db *SQLite) GetProcessedFiles(ctx context.Context) ([]string, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT file FROM files;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		err = rows.Scan(&file)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (db *SQLite) UpdateFile(ctx context.Context, file File) error {
+	var processedAt *time.Time
+	if file.ProcessedAt != nil {
+		utc := file.ProcessedAt.UTC()
+		processedAt = &utc
+	}
+
+	_, err := db.conn.ExecContext(ctx,
+		`UPDATE files SET status=?, rows_total=?, rows_parsed=?, rows_rejected=?, error=NULLIF(?, ''),
+			processed_at=? WHERE file=?;`,
+		file.Status, file.RowsTotal, file.RowsParsed, file.RowsRejected, file.Error, processedAt, file.Name)
+
+	return err
+}
+
+func (db *SQLite) AddFileErrors(ctx context.Context, filename string, fileErrors []FileError) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, fileError := range fileErrors {
+		_, err = tx.ExecContext(ctx, `INSERT INTO file_errors VALUES (?, ?, ?);`,
+			filename, fileError.Line, fileError.Error)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *SQLite) ListFiles(ctx context.Context, filter FilesFilter) ([]File, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+fileColumns+` FROM files
+			WHERE (?1 = '' OR status = ?1) AND (?2 = '' OR instr(file, ?2) > 0)
+			ORDER BY added_at DESC, file LIMIT ?3 OFFSET ?4;`,
+		filter.Status, filter.Name, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (db *SQLite) GetFile(ctx context.Context, filename string) (*File, []FileError, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+fileColumns+` FROM files WHERE file=?;`, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil, rows.Err()
+	}
+
+	file, err := scanFile(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	rows, err = db.conn.QueryContext(ctx,
+		`SELECT line, error FROM file_errors WHERE file=? ORDER BY line;`, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var fileErrors []FileError
+	for rows.Next() {
+		var fileError FileError
+		err = rows.Scan(&fileError.Line, &fileError.Error)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fileErrors = append(fileErrors, fileError)
+	}
+
+	return &file, fileErrors, rows.Err()
+}
+
+func (db *SQLite) ClearFileData(ctx context.Context, filename string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM data WHERE file=?;`, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM file_errors WHERE file=?;`, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE files SET status=?, rows_total=0, rows_parsed=0, rows_rejected=0, error=NULL, processed_at=NULL
+			WHERE file=?;`, FileQueued, filename)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *SQLite) AddDataRow(ctx context.Context, filename string, data []Record) error {
+	ctx, span := tracer.Start(ctx, "SQLite.AddDataRow")
+	defer span.End()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+
+	// units have to exist before rows referencing them
+	units := make(map[uuid.UUID]bool)
+	for _, row := range data {
+		if units[row.UnitGuid] {
+			continue
+		}
+		units[row.UnitGuid] = true
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO units (unit_guid, invid, first_seen, last_seen) VALUES (?1, ?2, ?3, ?3)
+			ON CONFLICT (unit_guid) DO UPDATE SET invid = excluded.invid, last_seen = excluded.last_seen;`,
+			row.UnitGuid, row.InvId, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO data (n, mqtt, unit_guid, msg_id, text, context, class, level,
+			area, addr, block, type, bit, invert_bit, file, ingested_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range data {
+		_, err = stmt.ExecContext(ctx,
+			row.N, row.MQTT, row.UnitGuid, row.MsgId, row.Text, row.Context, row.Class,
+			row.Level, row.Area, row.Addr, row.Block, row.Type, row.Bit, row.InvertBit, filename, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *SQLite) GetRecordsByGuid(ctx context.Context, guid uuid.UUID) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "SQLite.GetRecordsByGuid")
+	defer span.End()
+
+	return db.queryRecords(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE d.unit_guid=? ORDER BY d.rowid;`, guid)
+}
+
+func (db *SQLite) GetRecordsByFilter(ctx context.Context, guid uuid.UUID, filter RecordsFilter) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "SQLite.GetRecordsByFilter")
+	defer span.End()
+
+	where, args := sqliteRecordsFilter(guid, filter)
+
+	return db.queryRecords(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE `+where+` ORDER BY d.rowid;`, args...)
+}
+
+func (db *SQLite) GetUnitStats(ctx context.Context, guid uuid.UUID, filter RecordsFilter) (*UnitStats, error) {
+	ctx, span := tracer.Start(ctx, "SQLite.GetUnitStats")
+	defer span.End()
+
+	where, args := sqliteRecordsFilter(guid, filter)
+	stats := &UnitStats{}
+
+	err := db.conn.QueryRowContext(ctx,
+		`SELECT count(*), count(DISTINCT d.msg_id) FROM data d WHERE `+where+`;`, args...).
+		Scan(&stats.Records, &stats.MsgIds)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Classes, err = db.countBy(ctx, "d.class", where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Levels, err = db.countBy(ctx, "d.level", where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Areas, err = db.countBy(ctx, "d.area", where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// countBy counts records matching where by values of the column
+func (db *SQLite) countBy(ctx context.Context, column string, where string, args []interface{}) ([]Count, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+column+`, count(*) FROM data d WHERE `+where+` GROUP BY `+column+` ORDER BY `+column+`;`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []Count
+	for rows.Next() {
+		var count Count
+		err = rows.Scan(&count.Value, &count.Records)
+		if err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// sqliteRecordsFilter returns condition on data d selecting records of RecordsFilter,
+// sqlite has no arrays, so lists are expanded into placeholders
+func sqliteRecordsFilter(guid uuid.UUID, filter RecordsFilter) (string, []interface{}) {
+	where := []string{"d.unit_guid=?"}
+	args := []interface{}{guid}
+
+	if len(filter.Classes) > 0 {
+		where = append(where, "d.class IN ("+placeholders(len(filter.Classes))+")")
+		for _, class := range filter.Classes {
+			args = append(args, class)
+		}
+	}
+	if len(filter.Levels) > 0 {
+		where = append(where, "d.level IN ("+placeholders(len(filter.Levels))+")")
+		for _, level := range filter.Levels {
+			args = append(args, level)
+		}
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "d.ingested_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "d.ingested_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	return strings.Join(where, " AND "), args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (db *SQLite) GetDataAPI(ctx context.Context, guid uuid.UUID, offset int32, limit int32) ([]Record, error) {
+	ctx, span := tracer.Start(ctx, "SQLite.GetDataAPI")
+	defer span.End()
+
+	return db.queryRecords(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+` WHERE d.unit_guid=? ORDER BY d.rowid LIMIT ? OFFSET ?;`,
+		guid, limit, offset)
+}
+
+func (db *SQLite) queryRecords(ctx context.Context, query string, args ...interface{}) ([]Record, error) {
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allRecords []Record
+	for rows.Next() {
+		oneRecord, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		allRecords = append(allRecords, oneRecord)
+	}
+
+	return allRecords, rows.Err()
+}
+
+func (db *SQLite) GetUnits(ctx context.Context, filter *UnitsFilter, offset int32, limit int32) ([]Unit, error) {
+	where, args := sqliteUnitsFilter(filter)
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+unitColumns+`, (SELECT count(*) FROM data d WHERE d.unit_guid = u.unit_guid)
+			FROM units u `+where+` ORDER BY u.unit_guid LIMIT ? OFFSET ?;`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []Unit
+	for rows.Next() {
+		unit, err := scanUnit(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		units = append(units, unit)
+	}
+
+	return units, rows.Err()
+}
+
+func (db *SQLite) GetUnit(ctx context.Context, guid uuid.UUID) (*Unit, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+unitColumns+`, (SELECT count(*) FROM data d WHERE d.unit_guid = u.unit_guid)
+			FROM units u WHERE u.unit_guid=?;`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	unit, err := scanUnit(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unit, nil
+}
+
+func (db *SQLite) GetUnitFiles(ctx context.Context, guid uuid.UUID) ([]string, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT file FROM data WHERE unit_guid=? AND file IS NOT NULL GROUP BY file ORDER BY min(rowid);`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		err = rows.Scan(&file)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (db *SQLite) GetClassCounts(ctx context.Context, class string) (map[uuid.UUID]int64, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT unit_guid, count(*) FROM data WHERE class=? GROUP BY unit_guid;`, class)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[uuid.UUID]int64)
+	for rows.Next() {
+		var guid uuid.UUID
+		var count int64
+		err = rows.Scan(&guid, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[guid] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (db *SQLite) StreamRecordsByGuids(ctx context.Context, guids []uuid.UUID, batchSize int32, fn func([]Record) error) error {
+	ctx, span := tracer.Start(ctx, "SQLite.StreamRecordsByGuids")
+	defer span.End()
+
+	if batchSize < 1 {
+		return errors.New("batch size must be positive")
+	}
+
+	if len(guids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(guids))
+	for _, guid := range guids {
+		args = append(args, guid)
+	}
+
+	// rows are read lazily by the driver, so only one batch is kept in memory
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+recordColumns+` FROM `+recordsTable+`
+			WHERE d.unit_guid IN (?`+strings.Repeat(", ?", len(guids)-1)+`) ORDER BY d.rowid;`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batch := make([]Record, 0, batchSize)
+	for rows.Next() {
+		oneRecord, err := scanRecord(rows)
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, oneRecord)
+		if int32(len(batch)) < batchSize {
+			continue
+		}
+
+		err = fn(batch)
+		if err != nil {
+			return err
+		}
+		batch = make([]Record, 0, batchSize)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
+
+// CreatePartitions does nothing, months of SQLite data are only ranges of ingested_at in one table
+func (db *SQLite) CreatePartitions(ctx context.Context, from time.Time, months int) error {
+	return nil
+}
+
+func (db *SQLite) ListPartitions(ctx context.Context) ([]Partition, error) {
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT DISTINCT substr(ingested_at, 1, 7) AS month FROM data ORDER BY month;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var month string
+		err = rows.Scan(&month)
+		if err != nil {
+			return nil, err
+		}
+
+		from, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, err
+		}
+
+		partitions = append(partitions, Partition{Name: partitionName(from), From: from, To: from.AddDate(0, 1, 0)})
+	}
+
+	return partitions, rows.Err()
+}
+
+func (db *SQLite) ArchivePartition(ctx context.Context, name string, w io.Writer) error {
+	from, err := partitionMonth(name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.conn.QueryContext(ctx,
+		`SELECT `+recordColumns+`, d.file, d.ingested_at FROM `+recordsTable+`
+			WHERE d.ingested_at >= ? AND d.ingested_at < ? ORDER BY d.rowid;`,
+		from, from.AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// same layout as COPY ... WITH (FORMAT csv, DELIMITER E'\t', HEADER) of Postgres
+	out := csv.NewWriter(w)
+	out.Comma = '\t'
+
+	err = out.Write(archiveHeader)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var r Record
+		var file sql.NullString
+		var ingestedAt time.Time
+		err = rows.Scan(&r.N, &r.MQTT, &r.InvId, &r.UnitGuid, &r.MsgId, &r.Text, &r.Context, &r.Class, &r.Level,
+			&r.Area, &r.Addr, &r.Block, &r.Type, &r.Bit, &r.InvertBit, &file, &ingestedAt)
+		if err != nil {
+			return err
+		}
+
+		err = out.Write([]string{strconv.Itoa(r.N), byteaText(r.MQTT), r.InvId, r.UnitGuid.String(), r.MsgId,
+			r.Text, byteaText(r.Context), r.Class, strconv.Itoa(r.Level), r.Area, r.Addr, r.Block, r.Type,
+			strconv.Itoa(r.Bit), strconv.Itoa(r.InvertBit), file.String, ingestedAt.Format(sqliteTimeFormat)})
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+func (db *SQLite) DropPartition(ctx context.Context, name string) error {
+	from, err := partitionMonth(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.conn.ExecContext(ctx,
+		`DELETE FROM data WHERE ingested_at >= ? AND ingested_at < ?;`, from, from.AddDate(0, 1, 0))
+
+	return err
+}
+
+func partitionMonth(name string) (time.Time, error) {
+	month, err := time.Parse("2006_01", strings.TrimPrefix(name, partitionPrefix))
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid partition name %s", name)
+	}
+
+	return month, nil
+}
+
+// byteaText formats binary value like Postgres bytea hex output
+func byteaText(b []byte) string {
+	if b == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("\\x%x", b)
+}
+
+// sqliteUnitsFilter returns WHERE clause of UnitsFilter, GLOB is case sensitive like path.Match
+func sqliteUnitsFilter(filter *UnitsFilter) (string, []interface{}) {
+	if filter == nil {
+		return "", nil
+	}
+
+	conditions := []string{"0"}
+	var args []interface{}
+	for _, pattern := range filter.InvIds {
+		conditions = append(conditions, "u.invid GLOB ?")
+		args = append(args, pattern)
+	}
+	for _, pattern := range filter.UnitGuids {
+		conditions = append(conditions, "u.unit_guid GLOB ?")
+		args = append(args, pattern)
+	}
+
+	return "WHERE " + strings.Join(conditions, " OR "), args
+}
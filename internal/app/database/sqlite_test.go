@@ -0,0 +1,113 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+)
+
+// openSQLite opens a migrated database in a temporary directory removed with the test
+func openSQLite(t *testing.T) *database.SQLite {
+	t.Helper()
+
+	db, err := database.NewSQLite(&config.DB{SQLitePath: filepath.Join(t.TempDir(), "test.db"), AutoMigrate: true},
+		context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLite(t *testing.T) {
+	runConformance(t, func(t *testing.T) database.IDatabase {
+		return openSQLite(t)
+	})
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	status, err := db.MigrationsStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) == 0 {
+		t.Fatal("no migrations of sqlite driver")
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Fatalf("migration %d_%s is not applied on open", s.Version, s.Name)
+		}
+	}
+
+	err = db.MigrateDown(ctx, len(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.AddProcessedFile(ctx, "a.tsv") == nil {
+		t.Fatal("files table must not exist after all migrations are rolled back")
+	}
+
+	err = db.MigrateUp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddProcessedFile(ctx, "a.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteKeepsDataBetweenOpens(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.DB{Driver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db"), AutoMigrate: true}
+
+	db, err := database.Open(cfg, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addFiles(ctx, db, "a.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := testRecordsOf("inv-1", guidA, guidB)
+	err = db.AddDataRow(ctx, "a.tsv", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// migrations which are already applied are skipped on the second open
+	db, err = database.Open(cfg, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := db.GetProcessedFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "a.tsv" {
+		t.Fatalf("GetProcessedFiles = %v, want [a.tsv]", files)
+	}
+
+	got, err := db.GetRecordsByGuid(ctx, guidA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filterRecords(records, guidA)
+	if !recordsEqual(got, want) {
+		t.Fatalf("GetRecordsByGuid = %+v, want %+v", got, want)
+	}
+}
+
+func TestSQLitePathIsRequired(t *testing.T) {
+	_, err := database.NewSQLite(&config.DB{AutoMigrate: true}, context.Background())
+	if err == nil {
+		t.Fatal("NewSQLite without path must fail")
+	}
+}
@@ -2,24 +2,48 @@ package directory
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"test_task/internal/app/config"
 	"test_task/internal/app/database"
+	"test_task/internal/app/metrics"
 )
 
+var ErrFileExists = errors.New("file is already processed")
+
+var tracer = otel.Tracer("test_task/internal/app/directory")
+
+// QueuedFile is a file waiting for the parser, Span is the span which queued
+// it, so parsing continues the same trace
+type QueuedFile struct {
+	Path string
+	Span trace.SpanContext
+}
+
 type FilesDirectory struct {
 	path           string
 	delay          time.Duration
-	queue          chan string
+	queue          chan QueuedFile
 	db             database.IDatabase
 	processedFiles map[string]struct{}
+	mu             sync.Mutex
+	lastScan       time.Time
 
 	errChan chan error
 }
 
-func New(ctx context.Context, cfg config.FilesDirectory, queue chan string, db database.IDatabase, errChan chan error) (*FilesDirectory, error) {
+func New(ctx context.Context, cfg config.FilesDirectory, queue chan QueuedFile, db database.IDatabase, errChan chan error) (*FilesDirectory, error) {
 	dir := FilesDirectory{}
 
 	dir.path = cfg.FilesDirectory
@@ -36,6 +60,7 @@ func New(ctx context.Context, cfg config.FilesDirectory, queue chan string, db d
 	procFiles := make(map[string]struct{})
 	for _, file := range dbFiles {
 		procFiles[file] = struct{}{}
+		procFiles[dir.normalizeLegacy(file)] = struct{}{}
 	}
 	dir.processedFiles = procFiles
 
@@ -46,21 +71,127 @@ func (d *FilesDirectory) Run(ctx context.Context) {
 	for true {
 		dirFiles, err := ioutil.ReadDir(d.path)
 		if err != nil {
+			// lastScan is not updated, so health check reports the watcher as stale
 			d.errChan <- err
+			time.Sleep(d.delay)
+			continue
 		}
 
 		for _, file := range dirFiles {
-			filePath := d.path + "\\" + file.Name()
-			if _, ok := d.processedFiles[filePath]; !ok {
-				d.queue <- filePath
-				err = d.db.AddProcessedFile(ctx, filePath)
-				if err != nil {
-					d.errChan <- err
-				}
-				d.processedFiles[filePath] = struct{}{}
+			filePath := d.filePath(file.Name())
+			if !d.markProcessed(filePath) {
+				continue
+			}
+
+			err = d.discover(ctx, filePath)
+			if err != nil {
+				d.errChan <- err
 			}
 		}
 
+		d.mu.Lock()
+		d.lastScan = time.Now()
+		d.mu.Unlock()
+
 		time.Sleep(d.delay)
 	}
 }
+
+// LastScan is the time the directory was last fully scanned, zero before the first scan
+func (d *FilesDirectory) LastScan() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.lastScan
+}
+
+// AddFile stores uploaded file in the directory and queues it like a file found by Run
+func (d *FilesDirectory) AddFile(ctx context.Context, name string, r io.Reader) (string, error) {
+	filePath := d.filePath(name)
+	if !d.markProcessed(filePath) {
+		return "", ErrFileExists
+	}
+
+	err := writeFile(filePath, r)
+	if err != nil {
+		d.unmarkProcessed(filePath)
+		return "", err
+	}
+
+	return filePath, d.enqueue(ctx, filePath)
+}
+
+// Requeue sends already registered file to the parser again
+func (d *FilesDirectory) Requeue(ctx context.Context, filePath string) {
+	d.queue <- QueuedFile{Path: filePath, Span: trace.SpanContextFromContext(ctx)}
+}
+
+func (d *FilesDirectory) filePath(name string) string {
+	return filepath.Join(d.path, name)
+}
+
+// normalizeLegacy returns the path of a ledger entry recorded before paths were joined by filepath,
+// they were joined by backslash and would not match files found by Run otherwise
+func (d *FilesDirectory) normalizeLegacy(file string) string {
+	prefix := d.path + "\\"
+	if !strings.HasPrefix(file, prefix) {
+		return file
+	}
+
+	return d.filePath(strings.TrimPrefix(file, prefix))
+}
+
+// markProcessed returns false if the file was already taken
+func (d *FilesDirectory) markProcessed(filePath string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.processedFiles[filePath]; ok {
+		return false
+	}
+	d.processedFiles[filePath] = struct{}{}
+
+	return true
+}
+
+func (d *FilesDirectory) unmarkProcessed(filePath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.processedFiles, filePath)
+}
+
+func (d *FilesDirectory) discover(ctx context.Context, filePath string) error {
+	ctx, span := tracer.Start(ctx, "FilesDirectory.Run", trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("file", filePath)))
+	defer span.End()
+
+	return d.enqueue(ctx, filePath)
+}
+
+func (d *FilesDirectory) enqueue(ctx context.Context, filePath string) error {
+	metrics.FilesDiscovered.Inc()
+
+	// file must be in the ledger before parser starts updating its status
+	err := d.db.AddProcessedFile(ctx, filePath)
+
+	d.queue <- QueuedFile{Path: filePath, Span: trace.SpanContextFromContext(ctx)}
+
+	return err
+}
+
+func writeFile(filePath string, r io.Reader) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(filePath)
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"test_task/internal/app/config"
+	pb "test_task/proto"
+)
+
+// Gateway serves ApiService over HTTP/JSON. Requests are proxied to the gRPC
+// server of the same process, so they pass the same validation and interceptors
+type Gateway struct {
+	address      string
+	grpcEndpoint string
+	dialOpts     []grpc.DialOption
+
+	errChan chan error
+}
+
+func New(cfg config.Gateway, errChan chan error) (*Gateway, error) {
+	gw := &Gateway{}
+
+	gw.address = cfg.Address
+	gw.grpcEndpoint = cfg.GRPCEndpoint
+	gw.errChan = errChan
+
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	gw.dialOpts = []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor()),
+	}
+
+	return gw, nil
+}
+
+func (g *Gateway) Run(ctx context.Context) {
+	if g.address == "" {
+		return
+	}
+
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher))
+
+	err := pb.RegisterApiServiceHandlerFromEndpoint(ctx, mux, g.grpcEndpoint, g.dialOpts)
+	if err != nil {
+		g.errChan <- err
+		return
+	}
+
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/", mux)
+	httpMux.HandleFunc("/openapi.json", serveOpenAPI)
+
+	err = http.ListenAndServe(g.address, httpMux)
+	if err != nil {
+		g.errChan <- err
+	}
+}
+
+func transportCredentials(cfg config.Gateway) (credentials.TransportCredentials, error) {
+	if cfg.GRPCCAFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	pem, err := os.ReadFile(cfg.GRPCCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read gRPC CA file")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in %s", cfg.GRPCCAFile)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    pool,
+		ServerName: cfg.GRPCServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.GRPCCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.GRPCCertFile, cfg.GRPCKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load gateway client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// headerMatcher passes API key and request id headers to gRPC metadata in addition to the default ones
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "X-Api-Key") || strings.EqualFold(key, "X-Request-Id") {
+		return strings.ToLower(key), true
+	}
+
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(pb.OpenAPI)
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+	"test_task/internal/app/directory"
+)
+
+var services = []string{"", "api.ApiService", "api.AdminService"}
+
+// Checker periodically evaluates readiness of the service and reports it
+// through the standard grpc.health.v1 service
+type Checker struct {
+	db         database.IDatabase
+	dir        *directory.FilesDirectory
+	queueDepth func() int
+
+	interval          time.Duration
+	watcherStaleAfter time.Duration
+	maxQueueDepth     int
+
+	server *grpchealth.Server
+	ready  bool
+
+	errChan chan error
+}
+
+func New(cfg config.Health, db database.IDatabase, dir *directory.FilesDirectory, queueDepth func() int,
+	errChan chan error) (*Checker, error) {
+	c := &Checker{}
+
+	c.db = db
+	c.dir = dir
+	c.queueDepth = queueDepth
+	c.interval = cfg.Interval
+	c.watcherStaleAfter = cfg.WatcherStaleAfter
+	c.maxQueueDepth = cfg.MaxQueueDepth
+	c.errChan = errChan
+
+	c.server = grpchealth.NewServer()
+	c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return c, nil
+}
+
+func (c *Checker) Server() *grpchealth.Server {
+	return c.server
+}
+
+func (c *Checker) Run(ctx context.Context) {
+	start := time.Now()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		err := c.check(ctx, start)
+		if err == nil && !c.ready {
+			c.setStatus(healthpb.HealthCheckResponse_SERVING)
+		}
+		if err != nil && c.ready {
+			c.errChan <- errors.Errorf("service is not ready: %v", err)
+			c.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+		c.ready = err == nil
+
+		select {
+		case <-ctx.Done():
+			c.server.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, start time.Time) error {
+	pingCtx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+
+	err := c.db.Ping(pingCtx)
+	if err != nil {
+		return errors.Wrap(err, "database is unreachable")
+	}
+
+	lastScan := c.dir.LastScan()
+	if lastScan.IsZero() {
+		lastScan = start
+	}
+	if time.Since(lastScan) > c.watcherStaleAfter {
+		return errors.Errorf("files directory was not scanned since %s", lastScan.Format(time.RFC3339))
+	}
+
+	if depth := c.queueDepth(); depth > c.maxQueueDepth {
+		return errors.Errorf("parser queue depth %d exceeds %d", depth, c.maxQueueDepth)
+	}
+
+	return nil
+}
+
+func (c *Checker) setStatus(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range services {
+		c.server.SetServingStatus(service, status)
+	}
+}
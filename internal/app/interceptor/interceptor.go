@@ -0,0 +1,126 @@
+package interceptor
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const requestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns id assigned by RequestID interceptor or empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID takes request id from x-request-id metadata or generates a new one
+// and returns it to the client in the response header
+func RequestID() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withRequestID(ctx), req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+	}
+
+	return unary, stream
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDHeader); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = uuid.Must(uuid.NewV4()).String()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Logging writes method, result code and duration of every call
+func Logging() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+
+		return resp, err
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), info.FullMethod, start, err)
+
+		return err
+	}
+
+	return unary, stream
+}
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	if err != nil {
+		log.Printf("grpc: request_id=%s method=%s code=%s duration=%s error=%q",
+			RequestIDFromContext(ctx), method, status.Code(err), time.Since(start), err)
+		return
+	}
+
+	log.Printf("grpc: request_id=%s method=%s code=%s duration=%s",
+		RequestIDFromContext(ctx), method, codes.OK, time.Since(start))
+}
+
+// Recovery turns a panic in a handler into Internal error instead of crashing the process
+func Recovery() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ss.Context(), info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+
+	return unary, stream
+}
+
+func recovered(ctx context.Context, method string, r interface{}) error {
+	log.Printf("grpc: request_id=%s method=%s panic: %v\n%s", RequestIDFromContext(ctx), method, r, debug.Stack())
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
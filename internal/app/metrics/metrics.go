@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"test_task/internal/app/config"
+)
+
+const namespace = "biocad"
+
+var (
+	FilesDiscovered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_discovered_total",
+		Help:      "Files found in the files directory or uploaded.",
+	})
+	FilesProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_processed_total",
+		Help:      "Files parsed and stored in the database.",
+	})
+	FilesFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_failed_total",
+		Help:      "Files which could not be read or stored.",
+	})
+
+	RowsParsed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_parsed_total",
+		Help:      "Rows parsed into records.",
+	})
+	RowsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rows_rejected_total",
+		Help:      "Rows rejected by the parser by the column which failed.",
+	}, []string{"column"})
+
+	DBInsertDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_insert_duration_seconds",
+		Help:      "Time to insert records of one file.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+	RenderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Time to render and write one output file.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"format"})
+	ReportsFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reports_failed_total",
+		Help:      "Failed generations of unit_guid output files, they are retried on the next cycle.",
+	})
+
+	grpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Handled gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+	grpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Duration of gRPC requests by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+)
+
+// RegisterQueueDepth exposes current length of the parser queue
+func RegisterQueueDepth(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "parser_queue_depth",
+		Help:      "Files waiting in the parser queue.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// Since observes seconds elapsed from start, use as defer metrics.Since(h, time.Now())
+func Since(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// Server serves /metrics on its own address
+type Server struct {
+	address string
+
+	errChan chan error
+}
+
+func New(cfg config.Metrics, errChan chan error) (*Server, error) {
+	s := &Server{}
+
+	s.address = cfg.Address
+	s.errChan = errChan
+
+	return s, nil
+}
+
+func (s *Server) Run(ctx context.Context) {
+	if s.address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	err := http.ListenAndServe(s.address, mux)
+	if err != nil {
+		s.errChan <- err
+	}
+}
+
+func UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeCall(info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+func StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeCall(info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func observeCall(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,66 @@
+package outfile
+
+import (
+	"encoding/csv"
+	"io"
+
+	"test_task/internal/app/config"
+)
+
+// utf8BOM lets Excel detect encoding of Cyrillic text
+const utf8BOM = "\ufeff"
+
+type csvRenderer struct{}
+
+func newCSVRenderer(cfg config.OutFile) (Renderer, error) {
+	return &csvRenderer{}, nil
+}
+
+func (r *csvRenderer) Extension() string {
+	return "csv"
+}
+
+func (r *csvRenderer) Render(w io.Writer, doc Document) error {
+	_, err := io.WriteString(w, utf8BOM)
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+
+	// statistics table goes first and is separated from the table by an empty line
+	if len(doc.SummaryRows) > 0 {
+		err = out.Write(doc.SummaryColumns)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range doc.SummaryRows {
+			err = out.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = out.Write(nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = out.Write(doc.Columns)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range doc.Rows {
+		err = out.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
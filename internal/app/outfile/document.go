@@ -0,0 +1,33 @@
+package outfile
+
+// Document is a content of an output file independent of its format:
+// a title block, statistics and a table with a header repeated on every page
+type Document struct {
+	// Name identifies the document in page footers and sheet names
+	Name  string
+	Title string
+	// Lines are lines of the title block
+	Lines []string
+
+	// SummaryLines and SummaryRows are the same statistics as text and as a table of SummaryColumns,
+	// the last summary column is a number
+	SummaryLines   []string
+	SummaryColumns []string
+	SummaryRows    [][]string
+
+	Columns []string
+	Rows    [][]string
+	// Numeric are indexes of integer columns which tabular formats keep as numbers
+	Numeric []int
+}
+
+// isNumeric reports whether the column keeps integer values
+func (d Document) isNumeric(column int) bool {
+	for _, i := range d.Numeric {
+		if i == column {
+			return true
+		}
+	}
+
+	return false
+}
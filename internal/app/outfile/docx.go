@@ -0,0 +1,166 @@
+package outfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"test_task/internal/app/config"
+)
+
+const (
+	docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`
+
+	docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`
+)
+
+// docx sizes are in twips, font size in half-points
+const (
+	docxPageWidth  = 16838
+	docxPageHeight = 11906
+	docxMargin     = 567
+	docxFontSize   = 14
+)
+
+// docxRenderer writes a minimal WordprocessingML package with one table
+type docxRenderer struct{}
+
+func newDOCXRenderer(cfg config.OutFile) (Renderer, error) {
+	return &docxRenderer{}, nil
+}
+
+func (r *docxRenderer) Extension() string {
+	return "docx"
+}
+
+func (r *docxRenderer) Render(w io.Writer, doc Document) error {
+	z := zip.NewWriter(w)
+
+	parts := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(docxContentTypes)},
+		{"_rels/.rels", []byte(docxRels)},
+		{"word/document.xml", docxDocument(doc)},
+	}
+
+	for _, part := range parts {
+		pw, err := z.Create(part.name)
+		if err != nil {
+			return err
+		}
+
+		_, err = pw.Write(part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+func docxDocument(doc Document) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+
+	writeDOCXParagraph(&b, doc.Title, true)
+	for _, line := range doc.Lines {
+		writeDOCXParagraph(&b, line, false)
+	}
+	writeDOCXParagraph(&b, "", false)
+
+	if len(doc.SummaryLines) > 0 {
+		writeDOCXParagraph(&b, "Summary", true)
+		for _, line := range doc.SummaryLines {
+			writeDOCXParagraph(&b, line, false)
+		}
+		writeDOCXParagraph(&b, "", false)
+	}
+
+	b.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="5000" w:type="pct"/><w:tblBorders>` +
+		`<w:top w:val="single" w:sz="4"/><w:left w:val="single" w:sz="4"/><w:bottom w:val="single" w:sz="4"/>` +
+		`<w:right w:val="single" w:sz="4"/><w:insideH w:val="single" w:sz="4"/><w:insideV w:val="single" w:sz="4"/>` +
+		`</w:tblBorders></w:tblPr>`)
+
+	// the grid and cells share the widths, word processors fall back to their own layout when they differ
+	widths := docxColumnWidths(doc)
+	b.WriteString(`<w:tblGrid>`)
+	for _, width := range widths {
+		fmt.Fprintf(&b, `<w:gridCol w:w="%d"/>`, width)
+	}
+	b.WriteString(`</w:tblGrid>`)
+
+	writeDOCXRow(&b, doc.Columns, widths, true)
+	for _, row := range doc.Rows {
+		writeDOCXRow(&b, row, widths, false)
+	}
+
+	b.WriteString(`</w:tbl>`)
+
+	fmt.Fprintf(&b, `<w:sectPr><w:pgSz w:w="%d" w:h="%d" w:orient="landscape"/>`+
+		`<w:pgMar w:top="%[3]d" w:right="%[3]d" w:bottom="%[3]d" w:left="%[3]d"/></w:sectPr>`,
+		docxPageWidth, docxPageHeight, docxMargin)
+
+	b.WriteString(`</w:body></w:document>`)
+
+	return b.Bytes()
+}
+
+// docxColumnWidths splits the text width of the page between columns in twips
+func docxColumnWidths(doc Document) []int {
+	measure := func(s string) float64 {
+		return float64(utf8.RuneCountInString(s))
+	}
+	widths := columnWidths(doc.Columns, doc.Rows, docxPageWidth-2*docxMargin, measure)
+
+	twips := make([]int, len(widths))
+	for i, width := range widths {
+		twips[i] = int(width)
+	}
+
+	return twips
+}
+
+func writeDOCXParagraph(b *bytes.Buffer, text string, bold bool) {
+	b.WriteString(`<w:p><w:r><w:rPr>`)
+	if bold {
+		b.WriteString(`<w:b/>`)
+	}
+	fmt.Fprintf(b, `<w:sz w:val="%d"/></w:rPr><w:t xml:space="preserve">`, docxFontSize+4)
+	xml.EscapeText(b, []byte(text))
+	b.WriteString(`</w:t></w:r></w:p>`)
+}
+
+func writeDOCXRow(b *bytes.Buffer, cells []string, widths []int, header bool) {
+	b.WriteString(`<w:tr>`)
+	if header {
+		// header row is repeated on every page
+		b.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+	}
+
+	for i, cell := range cells {
+		fmt.Fprintf(b, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/></w:tcPr><w:p><w:r><w:rPr>`, widths[i])
+		if header {
+			b.WriteString(`<w:b/>`)
+		}
+		fmt.Fprintf(b, `<w:sz w:val="%d"/></w:rPr><w:t xml:space="preserve">`, docxFontSize)
+		xml.EscapeText(b, []byte(cell))
+		b.WriteString(`</w:t></w:r></w:p></w:tc>`)
+	}
+
+	b.WriteString(`</w:tr>`)
+}
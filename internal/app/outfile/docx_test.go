@@ -0,0 +1,31 @@
+package outfile
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDOCXTableHasGrid(t *testing.T) {
+	doc := Document{
+		Title:   "Unit",
+		Columns: []string{"n", "text"},
+		Rows:    [][]string{{"1", "Разморозка испарителя"}},
+	}
+	document := string(docxDocument(doc))
+
+	grid := regexp.MustCompile(`<w:gridCol w:w="(\d+)"/>`).FindAllStringSubmatch(document, -1)
+	if len(grid) != len(doc.Columns) {
+		t.Fatalf("table grid has %d columns, want %d", len(grid), len(doc.Columns))
+	}
+
+	// every cell has the width of its grid column
+	cells := regexp.MustCompile(`<w:tcW w:w="(\d+)" w:type="dxa"/>`).FindAllStringSubmatch(document, -1)
+	if len(cells) != len(doc.Columns)*(len(doc.Rows)+1) {
+		t.Fatalf("table has %d cell widths, want one per cell", len(cells))
+	}
+	for i, cell := range cells {
+		if want := grid[i%len(grid)][1]; cell[1] != want {
+			t.Fatalf("cell %d is %s twips wide, grid column is %s", i, cell[1], want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package outfile
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fpdf sizes are in millimeters, font size in points
+const (
+	fpdfMargin     = 10
+	fpdfFontSize   = 7
+	fpdfTitleSize  = 12
+	fpdfLineHeight = 3.5
+	fpdfPadding    = 0.5
+	fpdfFooter     = 6
+
+	// fpdfFont has Cyrillic glyphs unlike core PDF fonts
+	fpdfFont = "Go"
+)
+
+// fpdfRenderer draws PDF with open-source fpdf which needs neither network nor licence key
+type fpdfRenderer struct{}
+
+func newFPDFRenderer() (Renderer, error) {
+	return &fpdfRenderer{}, nil
+}
+
+func (r *fpdfRenderer) Extension() string {
+	return "pdf"
+}
+
+func (r *fpdfRenderer) Render(w io.Writer, doc Document) error {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fpdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(fpdfFont, "B", gobold.TTF)
+	pdf.SetMargins(fpdfMargin, fpdfMargin, fpdfMargin)
+	// rows are moved to the next page as a whole instead of automatic breaks inside cells
+	pdf.SetAutoPageBreak(false, fpdfMargin+fpdfFooter)
+
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		_, pageHeight := pdf.GetPageSize()
+		pdf.SetXY(fpdfMargin, pageHeight-fpdfMargin-fpdfLineHeight)
+		pdf.SetFont(fpdfFont, "", fpdfFontSize)
+		pdf.CellFormat(0, fpdfLineHeight, fmt.Sprintf("%s, page %d of {nb}", doc.Name, pdf.PageNo()),
+			"", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	drawFPDFTitle(pdf, doc)
+
+	t := newFPDFTable(pdf, doc.Columns, doc.Rows)
+	t.drawHeader()
+	for _, row := range doc.Rows {
+		t.drawRow(row)
+	}
+
+	return pdf.Output(w)
+}
+
+func drawFPDFTitle(pdf *fpdf.Fpdf, doc Document) {
+	pdf.SetFont(fpdfFont, "B", fpdfTitleSize)
+	pdf.CellFormat(0, fpdfTitleSize/2, doc.Title, "", 1, "L", false, 0, "")
+
+	pdf.SetFont(fpdfFont, "", fpdfFontSize+1)
+	for _, line := range doc.Lines {
+		pdf.MultiCell(0, fpdfLineHeight+0.5, line, "", "L", false)
+	}
+
+	if len(doc.SummaryLines) > 0 {
+		pdf.Ln(fpdfLineHeight / 2)
+		pdf.SetFont(fpdfFont, "B", fpdfFontSize+1)
+		pdf.CellFormat(0, fpdfLineHeight+0.5, "Summary", "", 1, "L", false, 0, "")
+
+		pdf.SetFont(fpdfFont, "", fpdfFontSize+1)
+		for _, line := range doc.SummaryLines {
+			pdf.MultiCell(0, fpdfLineHeight+0.5, line, "", "L", false)
+		}
+	}
+
+	pdf.Ln(fpdfLineHeight)
+}
+
+// fpdfTable draws rows of bordered cells with wrapped text, the header is repeated on every page
+type fpdfTable struct {
+	pdf    *fpdf.Fpdf
+	header []string
+	widths []float64
+}
+
+func newFPDFTable(pdf *fpdf.Fpdf, header []string, rows [][]string) *fpdfTable {
+	t := &fpdfTable{}
+
+	t.pdf = pdf
+	t.header = header
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	cellMargin := pdf.GetCellMargin()
+
+	// header is bold, so it is measured with the bold font
+	pdf.SetFont(fpdfFont, "B", fpdfFontSize)
+	widths := make([]float64, len(header))
+	for i, column := range header {
+		widths[i] = pdf.GetStringWidth(column) + 2*cellMargin
+	}
+
+	pdf.SetFont(fpdfFont, "", fpdfFontSize)
+	t.widths = fitColumnWidths(widths, rows, pageWidth-left-right, func(s string) float64 {
+		return pdf.GetStringWidth(s) + 2*cellMargin
+	})
+
+	return t
+}
+
+func (t *fpdfTable) drawHeader() {
+	t.pdf.SetFont(fpdfFont, "B", fpdfFontSize)
+	t.draw(t.header)
+	t.pdf.SetFont(fpdfFont, "", fpdfFontSize)
+}
+
+func (t *fpdfTable) drawRow(cells []string) {
+	_, pageHeight := t.pdf.GetPageSize()
+	_, breakMargin := t.pdf.GetAutoPageBreak()
+
+	if t.pdf.GetY()+t.height(cells) > pageHeight-breakMargin {
+		t.pdf.AddPage()
+		t.drawHeader()
+	}
+
+	t.draw(cells)
+}
+
+func (t *fpdfTable) height(cells []string) float64 {
+	maxLines := 1
+	for i, cell := range cells {
+		if lines := len(t.pdf.SplitText(cell, t.widths[i])); lines > maxLines {
+			maxLines = lines
+		}
+	}
+
+	return float64(maxLines)*fpdfLineHeight + 2*fpdfPadding
+}
+
+func (t *fpdfTable) draw(cells []string) {
+	height := t.height(cells)
+	left, _, _, _ := t.pdf.GetMargins()
+
+	x, y := left, t.pdf.GetY()
+	for i, cell := range cells {
+		t.pdf.Rect(x, y, t.widths[i], height, "D")
+
+		t.pdf.SetXY(x, y+fpdfPadding)
+		for _, line := range t.pdf.SplitText(cell, t.widths[i]) {
+			t.pdf.CellFormat(t.widths[i], fpdfLineHeight, line, "", 2, "L", false, 0, "")
+		}
+
+		x += t.widths[i]
+	}
+
+	t.pdf.SetXY(left, y+height)
+}
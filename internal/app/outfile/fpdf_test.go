@@ -0,0 +1,21 @@
+package outfile
+
+import (
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestFPDFTableMeasuresHeaderByPosition(t *testing.T) {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(fpdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(fpdfFont, "B", gobold.TTF)
+
+	// the cell of the second column has the text of the first header, but it is not bold
+	table := newFPDFTable(pdf, []string{"alarm", "n"}, [][]string{{"i", "alarm"}})
+	if table.widths[1] >= table.widths[0] {
+		t.Fatalf("widths = %v, regular cell is measured as wide as the bold header", table.widths)
+	}
+}
@@ -1,11 +1,445 @@
 package outfile
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"test_task/internal/app/config"
 	"test_task/internal/app/database"
+	"test_task/internal/app/metrics"
 )
 
+var tracer = otel.Tracer("test_task/internal/app/outfile")
+
+// retryInterval is how often failed guids are retried when there is no debounce
+const retryInterval = 30 * time.Second
+
+// maxPendingLinks limits spans a pending guid is linked to when it changes many times during debounce
+const maxPendingLinks = 16
+
 type IOutFile interface {
+	// WriteData regenerates files of unit_guids of the records, later in Run when debounce is set
 	WriteData(ctx context.Context, records []database.Record) error
+	// Run regenerates pending guids, on cancellation of ctx it writes all of them and returns
+	Run(ctx context.Context)
+	// Done is closed when Run returned
+	Done() <-chan struct{}
+}
+
+// formats is a registry of output formats which can be selected in config
+var formats = map[string]func(cfg config.OutFile) (Renderer, error){
+	"pdf":  newPDFRenderer,
+	"rtf":  newRTFRenderer,
+	"docx": newDOCXRenderer,
+	"csv":  newCSVRenderer,
+	"xlsx": newXLSXRenderer,
+}
+
+// Formats returns names of registered output formats in alphabetical order
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewRenderer returns renderer of the format registered under the name
+func NewRenderer(cfg config.OutFile, format string) (Renderer, error) {
+	newRenderer, ok := formats[format]
+	if !ok {
+		return nil, errors.Errorf("unknown output format: %s", format)
+	}
+
+	return newRenderer(cfg)
+}
+
+// Files writes a file of every configured format for each unit_guid.
+// Files of a guid are regenerated only when its data changed since they were written
+type Files struct {
+	outFilesDir string
+	formats     []string
+	renderers   map[string]Renderer
+	db          database.IDatabase
+	debounce    time.Duration
+	// keepVersions is how many timestamped versions of every file are kept, 0 keeps only the latest
+	keepVersions int
+	// overviewInterval is how often the overview of all units is written, 0 disables it
+	overviewInterval time.Duration
+
+	mu sync.Mutex
+	// versions are versions of data the files of guids were written from
+	versions map[uuid.UUID]string
+	// pending are guids waiting for regeneration
+	pending map[uuid.UUID]pendingUnit
+	// failures are numbers of failed generations in a row by guid
+	failures map[uuid.UUID]int
+
+	done    chan struct{}
+	errChan chan error
+}
+
+type pendingUnit struct {
+	// changed is time of the last change
+	changed time.Time
+	// links are spans which changed the unit, regeneration runs later on its own trace
+	links []trace.Link
+}
+
+func New(cfg config.OutFile, db database.IDatabase, errChan chan error) (*Files, error) {
+	f := Files{}
+
+	f.outFilesDir = cfg.Directory
+	f.db = db
+	f.debounce = cfg.Debounce
+	f.keepVersions = cfg.KeepVersions
+	f.overviewInterval = cfg.OverviewInterval
+	f.errChan = errChan
+	f.renderers = make(map[string]Renderer)
+	f.versions = make(map[uuid.UUID]string)
+	f.pending = make(map[uuid.UUID]pendingUnit)
+	f.failures = make(map[uuid.UUID]int)
+	f.done = make(chan struct{})
+
+	for _, format := range cfg.Formats {
+		if _, ok := f.renderers[format]; ok {
+			continue
+		}
+
+		renderer, err := NewRenderer(cfg, format)
+		if err != nil {
+			return nil, err
+		}
+
+		f.formats = append(f.formats, format)
+		f.renderers[format] = renderer
+	}
+
+	if len(f.formats) == 0 {
+		return nil, errors.New("no output formats are configured")
+	}
+
+	return &f, nil
+}
+
+func (f *Files) WriteData(ctx context.Context, records []database.Record) error {
+	ctx, span := tracer.Start(ctx, "Files.WriteData")
+	defer span.End()
+
+	// sort slice
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UnitGuid.String() > records[j].UnitGuid.String()
+	})
+
+	// get all unique guid
+	uniqGuids := getUniqueGUid(records)
+
+	if f.debounce > 0 {
+		f.mu.Lock()
+		for _, guid := range uniqGuids {
+			f.queue(guid, time.Now(), trace.LinkFromContext(ctx))
+		}
+		f.mu.Unlock()
+
+		return nil
+	}
+
+	// one failed guid does not stop others, the first error is returned
+	var firstErr error
+	for _, guid := range uniqGuids {
+		err := f.generate(ctx, guid)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Run regenerates pending guids which had no changes during the debounce window,
+// retries guids which failed before and writes the fleet overview.
+// Guids still pending when ctx is cancelled are written before Run returns
+func (f *Files) Run(ctx context.Context) {
+	defer close(f.done)
+
+	err := f.queueStale(ctx)
+	if err != nil {
+		f.errChan <- errors.Errorf("find stale out files error: %v", err)
+	}
+
+	interval := f.debounce
+	if interval <= 0 {
+		interval = retryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// overview is written on start and then once per interval
+	var overviews <-chan time.Time
+	if f.overviewInterval > 0 {
+		f.writeOverview(ctx)
+
+		overviewTicker := time.NewTicker(f.overviewInterval)
+		defer overviewTicker.Stop()
+		overviews = overviewTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.flush()
+			return
+		case <-overviews:
+			f.writeOverview(ctx)
+		case <-ticker.C:
+			for guid, links := range f.takePending(time.Now().Add(-f.debounce)) {
+				err := f.generate(ctx, guid, links...)
+				if err != nil {
+					f.errChan <- errors.Errorf("write to out file error: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func (f *Files) Done() <-chan struct{} {
+	return f.done
+}
+
+// flush writes every pending guid regardless of debounce, failed guids are not retried
+func (f *Files) flush() {
+	// ctx of Run is already cancelled, database calls need a live one
+	ctx := context.Background()
+
+	for guid, links := range f.takePending(time.Now().Add(time.Hour)) {
+		err := f.generate(ctx, guid, links...)
+		if err != nil {
+			f.errChan <- errors.Errorf("write to out file error: %v", err)
+		}
+	}
+}
+
+// queueStale makes pending the guids whose files are missing or older than their data.
+// Pending guids and versions are kept in memory only, so they are rebuilt after restart this way
+func (f *Files) queueStale(ctx context.Context) error {
+	for offset := int32(0); ; offset += overviewPageSize {
+		units, err := f.db.GetUnits(ctx, nil, offset, overviewPageSize)
+		if err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		for _, unit := range units {
+			if f.isStale(unit) {
+				// zero time is taken by the first tick regardless of debounce
+				f.queue(unit.Guid, time.Time{}, trace.Link{})
+			}
+		}
+		f.mu.Unlock()
+
+		if len(units) < overviewPageSize {
+			return nil
+		}
+	}
+}
+
+// isStale reports whether a file of the unit in any format is missing or modified before the last data of the unit
+func (f *Files) isStale(unit database.Unit) bool {
+	for _, format := range f.formats {
+		info, err := os.Stat(f.latestPath(unit.Guid.String(), f.renderers[format].Extension()))
+		if err != nil || info.ModTime().Before(unit.LastSeen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Files) writeOverview(ctx context.Context) {
+	err := f.WriteOverview(ctx)
+	if err != nil {
+		f.errChan <- errors.Errorf("write overview error: %v", err)
+	}
+}
+
+// queue makes the guid pending as changed at the time by the span of the link, f.mu must be held
+func (f *Files) queue(guid uuid.UUID, changed time.Time, link trace.Link) {
+	unit := f.pending[guid]
+	unit.changed = changed
+	if link.SpanContext.IsValid() && len(unit.links) < maxPendingLinks {
+		unit.links = append(unit.links, link)
+	}
+
+	f.pending[guid] = unit
+}
+
+// takePending removes from pending and returns guids last changed before the time with their span links
+func (f *Files) takePending(before time.Time) map[uuid.UUID][]trace.Link {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	guids := make(map[uuid.UUID][]trace.Link)
+	for guid, unit := range f.pending {
+		if unit.changed.Before(before) {
+			guids[guid] = unit.links
+			delete(f.pending, guid)
+		}
+	}
+
+	return guids
+}
+
+// generate regenerates files of the guid, a failed guid is recorded and pending again for the next cycle.
+// Links are spans which made the guid pending
+func (f *Files) generate(ctx context.Context, guid uuid.UUID, links ...trace.Link) error {
+	err := f.regenerate(ctx, guid, links)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.failures, guid)
+		return nil
+	}
+
+	metrics.ReportsFailed.Inc()
+	f.failures[guid]++
+	if _, ok := f.pending[guid]; !ok {
+		f.pending[guid] = pendingUnit{changed: time.Now(), links: links}
+	}
+
+	return errors.Wrapf(err, "unit %s, attempt %d", guid, f.failures[guid])
+}
+
+// regenerate writes files of the guid unless they were already written from the same data
+func (f *Files) regenerate(ctx context.Context, guid uuid.UUID, links []trace.Link) error {
+	ctx, span := tracer.Start(ctx, "Files.regenerate",
+		trace.WithAttributes(attribute.String("unit_guid", guid.String())), trace.WithLinks(links...))
+	defer span.End()
+
+	unit, err := f.db.GetUnit(ctx, guid)
+	if err != nil {
+		return err
+	}
+	if unit == nil {
+		return nil
+	}
+
+	// the version is compared before the history of the unit is loaded
+	version := unitVersion(unit)
+	f.mu.Lock()
+	written := f.versions[guid] == version
+	f.mu.Unlock()
+
+	span.SetAttributes(attribute.Bool("unchanged", written))
+	if written {
+		return nil
+	}
+
+	// get all records for guid
+	report, err := NewReport(ctx, f.db, guid, database.RecordsFilter{})
+	if err != nil {
+		return err
+	}
+
+	for _, format := range f.formats {
+		err = f.WriteReport(ctx, format, report)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	f.versions[guid] = version
+	f.mu.Unlock()
+
+	return nil
+}
+
+// unitVersion changes whenever records of the unit are added or removed,
+// last_seen is updated by every insert and the count by deletes
+func unitVersion(unit *database.Unit) string {
+	return fmt.Sprintf("%d/%d", unit.Records, unit.LastSeen.UnixNano())
+}
+
+// WriteReport renders report in the format and writes it to <unit_guid>.<extension>,
+// a symlink to <unit_guid>.<timestamp>.<extension> when versions are kept
+func (f *Files) WriteReport(ctx context.Context, format string, report Report) error {
+	_, span := tracer.Start(ctx, "Files.WriteReport", trace.WithAttributes(
+		attribute.String("unit_guid", report.Guid.String()), attribute.String("format", format),
+		attribute.Int("records", len(report.Records))))
+	defer span.End()
+
+	return f.writeDocument(format, report.Document(), report.GeneratedAt)
+}
+
+// WriteOverview writes overview of all units to overview.<extension> in every format
+func (f *Files) WriteOverview(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Files.WriteOverview")
+	defer span.End()
+
+	overview, err := NewOverview(ctx, f.db, nil)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("units", len(overview.Units)))
+
+	doc := overview.Document()
+	for _, format := range f.formats {
+		err = f.writeDocument(format, doc, overview.GeneratedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *Files) writeDocument(format string, doc Document, generatedAt time.Time) error {
+	defer metrics.Since(metrics.RenderDuration.WithLabelValues(format), time.Now())
+
+	renderer := f.renderers[format]
+
+	var buf bytes.Buffer
+	err := renderer.Render(&buf, doc)
+	if err != nil {
+		return err
+	}
+
+	// Write to output file.
+	err = f.writeVersion(doc.Name, renderer.Extension(), generatedAt, buf.Bytes())
+	if err != nil {
+		return errors.Wrapf(err, "write %s file", format)
+	}
+
+	return nil
+}
+
+func getUniqueGUid(records []database.Record) []uuid.UUID {
+
+	var uniqGuids []uuid.UUID
+	var prevGuid uuid.UUID
+	for _, record := range records {
+		if record.UnitGuid != prevGuid {
+			uniqGuids = append(uniqGuids, record.UnitGuid)
+			prevGuid = record.UnitGuid
+		} else {
+			continue
+		}
+	}
+
+	return uniqGuids
 }
@@ -0,0 +1,239 @@
+package outfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+)
+
+var testGuid = uuid.FromStringOrNil("1d7e4b4c-5a3e-4c4f-9b1a-6f0c2a7d8e01")
+
+// newTestFiles returns csv files of a memory database with one record of testGuid
+func newTestFiles(t *testing.T, debounce time.Duration) (*Files, *database.Memory, chan error) {
+	t.Helper()
+	ctx := context.Background()
+
+	db := database.NewMemory()
+	err := db.AddProcessedFile(ctx, "a.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddDataRow(ctx, "a.tsv", []database.Record{{N: 1, InvId: "inv-1", UnitGuid: testGuid, Class: "alarm"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errChan := make(chan error, 16)
+	f, err := New(config.OutFile{Directory: t.TempDir(), Formats: []string{"csv"}, Debounce: debounce}, db, errChan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f, db, errChan
+}
+
+func runFiles(f *Files) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.Run(ctx)
+
+	return cancel
+}
+
+func waitDone(t *testing.T, f *Files, errChan chan error) {
+	t.Helper()
+
+	select {
+	case <-f.Done():
+	case err := <-errChan:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
+
+func waitFile(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := os.Stat(path)
+		if err == nil {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s is not written", path)
+
+	return nil
+}
+
+func TestRunFlushesPendingOnCancel(t *testing.T) {
+	f, _, errChan := newTestFiles(t, time.Hour)
+	path := f.latestPath(testGuid.String(), "csv")
+
+	// files are up to date, so only the guid of WriteData is pending
+	time.Sleep(50 * time.Millisecond)
+	err := writeFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := runFiles(f)
+	err = f.WriteData(context.Background(), []database.Record{{UnitGuid: testGuid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitDone(t, f, errChan)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Fatal("pending guid is not written on cancel")
+	}
+}
+
+func TestRunRegeneratesStaleFiles(t *testing.T) {
+	f, _, errChan := newTestFiles(t, 10*time.Millisecond)
+	path := f.latestPath(testGuid.String(), "csv")
+
+	// a file written before the last data of the unit is stale after restart
+	err := writeFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	err = os.Chtimes(path, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := runFiles(f)
+	defer cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info := waitFile(t, path)
+		if info.Size() > 0 {
+			return
+		}
+		select {
+		case err := <-errChan:
+			t.Fatal(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("stale file is not regenerated")
+}
+
+func TestRunSkipsFreshFiles(t *testing.T) {
+	f, _, errChan := newTestFiles(t, time.Hour)
+
+	// mtime is taken from a coarser clock than time.Now
+	time.Sleep(50 * time.Millisecond)
+	err := writeFile(f.latestPath(testGuid.String(), "csv"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.queueStale(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.pending) != 0 {
+		t.Fatalf("pending = %v, want none for files newer than data", f.pending)
+	}
+
+	select {
+	case err := <-errChan:
+		t.Fatal(err)
+	default:
+	}
+}
+
+func TestRegenerateSkipsUnchangedContent(t *testing.T) {
+	f, db, _ := newTestFiles(t, 0)
+	ctx := context.Background()
+	path := filepath.Join(f.outFilesDir, testGuid.String()+".csv")
+
+	err := f.generate(ctx, testGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same data written again keeps the file
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.generate(ctx, testGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file of unchanged data is written again: %v", err)
+	}
+
+	err = db.AddDataRow(ctx, "a.tsv", []database.Record{{N: 2, InvId: "inv-1", UnitGuid: testGuid, Class: "working"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.generate(ctx, testGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Fatalf("file of changed data is not written: %v", err)
+	}
+}
+
+func TestDebouncedRegenerationIsLinkedToWriteData(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	f, _, _ := newTestFiles(t, time.Hour)
+
+	err := f.WriteData(context.Background(), []database.Record{{UnitGuid: testGuid}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for guid, links := range f.takePending(time.Now().Add(time.Hour)) {
+		err = f.generate(context.Background(), guid, links...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var writeData, regenerate sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "Files.WriteData":
+			writeData = span
+		case "Files.regenerate":
+			regenerate = span
+		}
+	}
+	if writeData == nil || regenerate == nil {
+		t.Fatalf("spans are not recorded: %v", recorder.Ended())
+	}
+
+	links := regenerate.Links()
+	if len(links) != 1 || links[0].SpanContext.SpanID() != writeData.SpanContext().SpanID() {
+		t.Fatalf("regenerate is linked to %v, want the span of WriteData", links)
+	}
+}
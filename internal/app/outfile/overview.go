@@ -0,0 +1,87 @@
+package outfile
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"test_task/internal/app/database"
+)
+
+const (
+	// overviewName is a file name of the overview without extension
+	overviewName = "overview"
+	alarmClass   = "alarm"
+	// overviewPageSize is how many units are read from the database at once
+	overviewPageSize = 1000
+)
+
+var overviewColumns = []string{"unit_guid", "invid", "records", "alarms", "first_seen", "last_seen"}
+
+// Overview lists every unit of the fleet
+type Overview struct {
+	GeneratedAt time.Time
+	Units       []OverviewUnit
+}
+
+type OverviewUnit struct {
+	database.Unit
+	Alarms int64
+}
+
+// NewOverview returns overview of units matching the filter ordered by guid, nil filter selects all units
+func NewOverview(ctx context.Context, db database.IDatabase, filter *database.UnitsFilter) (Overview, error) {
+	alarms, err := db.GetClassCounts(ctx, alarmClass)
+	if err != nil {
+		return Overview{}, err
+	}
+
+	overview := Overview{GeneratedAt: time.Now()}
+	for offset := int32(0); ; offset += overviewPageSize {
+		units, err := db.GetUnits(ctx, filter, offset, overviewPageSize)
+		if err != nil {
+			return Overview{}, err
+		}
+
+		for _, unit := range units {
+			overview.Units = append(overview.Units, OverviewUnit{Unit: unit, Alarms: alarms[unit.Guid]})
+		}
+
+		if len(units) < overviewPageSize {
+			return overview, nil
+		}
+	}
+}
+
+// Document returns the overview in a form drawn by renderers
+func (o Overview) Document() Document {
+	var records, alarms int64
+	rows := make([][]string, 0, len(o.Units))
+	for _, unit := range o.Units {
+		records += unit.Records
+		alarms += unit.Alarms
+
+		rows = append(rows, []string{
+			unit.Guid.String(),
+			unit.InvId,
+			strconv.FormatInt(unit.Records, 10),
+			strconv.FormatInt(unit.Alarms, 10),
+			unit.FirstSeen.Format(timeFormat),
+			unit.LastSeen.Format(timeFormat),
+		})
+	}
+
+	return Document{
+		Name:  overviewName,
+		Title: "Fleet overview",
+		Lines: []string{
+			"Generated: " + o.GeneratedAt.Format(timeFormat),
+			"Units: " + strconv.Itoa(len(o.Units)),
+			"Records: " + strconv.FormatInt(records, 10),
+			"Alarms: " + strconv.FormatInt(alarms, 10),
+		},
+		Columns: overviewColumns,
+		Rows:    rows,
+		Numeric: []int{2, 3},
+	}
+}
@@ -0,0 +1,37 @@
+package outfile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"test_task/internal/app/database"
+)
+
+func TestNewOverviewFiltersUnits(t *testing.T) {
+	_, db, _ := newTestFiles(t, 0)
+	ctx := context.Background()
+
+	other := uuid.FromStringOrNil("9a0b1c2d-3e4f-4a5b-8c6d-7e8f9a0b1c2d")
+	err := db.AddDataRow(ctx, "a.tsv", []database.Record{{N: 2, InvId: "inv-2", UnitGuid: other, Class: "alarm"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overview, err := NewOverview(ctx, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overview.Units) != 2 {
+		t.Fatalf("overview without filter has %d units, want 2", len(overview.Units))
+	}
+
+	overview, err = NewOverview(ctx, db, &database.UnitsFilter{InvIds: []string{"inv-2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overview.Units) != 1 || overview.Units[0].Guid != other || overview.Units[0].Alarms != 1 {
+		t.Fatalf("filtered overview = %+v, want only %s with 1 alarm", overview.Units, other)
+	}
+}
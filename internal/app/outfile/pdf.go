@@ -1,146 +1,146 @@
 package outfile
 
 import (
-	"context"
-	"log"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
-	"sort"
-	"strconv"
+	"unicode/utf8"
 
-	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 	"github.com/unidoc/unipdf/v3/common/license"
 	"github.com/unidoc/unipdf/v3/creator"
 	"github.com/unidoc/unipdf/v3/model"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
 
-	"test_task/internal/app/database"
+	"test_task/internal/app/config"
 )
 
-type PDFFile struct {
-	outFilesDir string
-	db          database.IDatabase
+func newPDFRenderer(cfg config.OutFile) (Renderer, error) {
+	switch cfg.PDFRenderer {
+	case "", "fpdf":
+		return newFPDFRenderer()
+	case "unipdf":
+		return newUniPDFRenderer()
+	default:
+		return nil, errors.Errorf("unknown pdf renderer: %s", cfg.PDFRenderer)
+	}
 }
 
-func New(outFilesDir string, db database.IDatabase) (*PDFFile, error) {
-	pdf := PDFFile{}
-
-	pdf.outFilesDir = outFilesDir
-	pdf.db = db
+// uniPDFRenderer draws PDF with unipdf, it needs a metered licence key and network access
+type uniPDFRenderer struct{}
 
+func newUniPDFRenderer() (Renderer, error) {
 	err := license.SetMeteredKey(os.Getenv(`PDF_API_KEY`))
 	if err != nil {
 		return nil, err
 	}
 
-	return &pdf, nil
+	return &uniPDFRenderer{}, nil
 }
 
-func (f *PDFFile) WriteData(ctx context.Context, records []database.Record) error {
-	// sort slice
-	sort.Slice(records, func(i, j int) bool {
-		return records[i].UnitGuid.String() > records[j].UnitGuid.String()
-	})
-
-	// get all unique guid
-	uniqGuids := getUniqueGUid(records)
-
-	for _, guid := range uniqGuids {
-		// get all records for guid
-		allRec, err := f.db.GetRecordsByGuid(ctx, guid)
-		if err != nil {
-			return nil
-		}
-
-		// write all records in pdf file
-		err = f.WriteToPdf(allRec)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+func (r *uniPDFRenderer) Extension() string {
+	return "pdf"
 }
 
-func (f *PDFFile) WriteToPdf(records []database.Record) error {
-	c, err := createPdf(records)
+func (r *uniPDFRenderer) Render(w io.Writer, doc Document) error {
+	c, err := createPdf(doc)
 	if err != nil {
 		return err
 	}
 
-	// Write to output file.
-	if err := c.WriteToFile(f.outFilesDir + "\\" + records[0].UnitGuid.String() + ".pdf"); err != nil {
-		log.Fatal(err)
-	}
-
-	return nil
+	return c.Write(w)
 }
 
-func getUniqueGUid(records []database.Record) []uuid.UUID {
+func createPdf(doc Document) (*creator.Creator, error) {
+	// Create report fonts, Go fonts have Cyrillic glyphs unlike Standard14 ones.
+	font, err := model.NewCompositePdfFontFromTTF(bytes.NewReader(goregular.TTF))
+	if err != nil {
+		return nil, err
+	}
 
-	var uniqGuids []uuid.UUID
-	var prevGuid uuid.UUID
-	for _, record := range records {
-		if record.UnitGuid != prevGuid {
-			uniqGuids = append(uniqGuids, record.UnitGuid)
-			prevGuid = record.UnitGuid
-		} else {
-			continue
-		}
+	fontBold, err := model.NewCompositePdfFontFromTTF(bytes.NewReader(gobold.TTF))
+	if err != nil {
+		return nil, err
 	}
 
-	return uniqGuids
-}
+	c := creator.New()
+	pageSize := creator.PageSize{creator.PageSizeA4[1], creator.PageSizeA4[0]}
+	c.SetPageSize(pageSize)
+	c.SetPageMargins(30, 30, 30, 40)
+
+	c.DrawFooter(func(block *creator.Block, args creator.FooterFunctionArgs) {
+		p := c.NewStyledParagraph()
+		chunk := p.Append(fmt.Sprintf("%s, page %d of %d", doc.Name, args.PageNum, args.TotalPages))
+		chunk.Style.Font = font
+		chunk.Style.FontSize = 8
+		p.SetTextAlignment(creator.TextAlignmentCenter)
+		p.SetPos(0, block.Height()-25)
+		p.SetWidth(block.Width())
+
+		_ = block.Draw(p)
+	})
+
+	// Draw title block.
+	title := c.NewStyledParagraph()
+	chunk := title.Append(doc.Title)
+	chunk.Style.Font = fontBold
+	chunk.Style.FontSize = 14
+	title.SetMargins(0, 0, 0, 5)
 
-func createPdf(records []database.Record) (*creator.Creator, error) {
-	// Create report fonts.
-	font, err := model.NewStandard14Font("Helvetica")
+	err = c.Draw(title)
 	if err != nil {
 		return nil, err
 	}
 
-	fontBold, err := model.NewStandard14Font("Helvetica-Bold")
+	err = drawLines(c, doc.Lines, font)
 	if err != nil {
 		return nil, err
 	}
 
-	c := creator.New()
-	pageSize := creator.PageSize{creator.PageSizeA4[1], creator.PageSizeA4[0]}
-	c.SetPageSize(pageSize)
+	// Draw statistics before the table.
+	if len(doc.SummaryLines) > 0 {
+		summary := c.NewStyledParagraph()
+		summary.Append("Summary").Style.Font = fontBold
+		summary.SetMargins(0, 0, 5, 0)
+
+		err = c.Draw(summary)
+		if err != nil {
+			return nil, err
+		}
+
+		err = drawLines(c, doc.SummaryLines, font)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	table := c.NewTable(15)
+	table := c.NewTable(len(doc.Columns))
 	table.SetMargins(0, 0, 10, 0)
+	// header row is repeated on every page
+	err = table.SetHeaderRows(1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// widths are fractions of the table width, text length is close enough for them
+	err = table.SetColumnWidths(columnWidths(doc.Columns, doc.Rows, 1, func(s string) float64 {
+		return float64(utf8.RuneCountInString(s) + 2)
+	})...)
+	if err != nil {
+		return nil, err
+	}
 
 	// Draw table header.
-	addCell(c, table, "n", fontBold)
-	addCell(c, table, "mqtt", fontBold)
-	addCell(c, table, "invid", fontBold)
-	addCell(c, table, "unit_guid", fontBold)
-	addCell(c, table, "msg_id", fontBold)
-	addCell(c, table, "text", fontBold)
-	addCell(c, table, "context", fontBold)
-	addCell(c, table, "class", fontBold)
-	addCell(c, table, "level", fontBold)
-	addCell(c, table, "area", fontBold)
-	addCell(c, table, "addr", fontBold)
-	addCell(c, table, "block", fontBold)
-	addCell(c, table, "type", fontBold)
-	addCell(c, table, "bit", fontBold)
-	addCell(c, table, "invert_bit", fontBold)
-
-	for _, record := range records {
-		addCell(c, table, strconv.Itoa(record.N), font)
-		addCell(c, table, string(record.MQTT), font)
-		addCell(c, table, record.InvId, font)
-		addCell(c, table, record.UnitGuid.String(), font)
-		addCell(c, table, record.MsgId, font)
-		addCell(c, table, record.Text, font)
-		addCell(c, table, string(record.Context), font)
-		addCell(c, table, record.Class, font)
-		addCell(c, table, strconv.Itoa(record.Level), font)
-		addCell(c, table, record.Area, font)
-		addCell(c, table, record.Addr, font)
-		addCell(c, table, record.Block, font)
-		addCell(c, table, record.Type, font)
-		addCell(c, table, strconv.Itoa(record.Bit), font)
-		addCell(c, table, strconv.Itoa(record.InvertBit), font)
+	for _, column := range doc.Columns {
+		addCell(c, table, column, fontBold)
+	}
+
+	for _, row := range doc.Rows {
+		for _, cell := range row {
+			addCell(c, table, cell, font)
+		}
 	}
 
 	err = c.Draw(table)
@@ -151,11 +151,27 @@ func createPdf(records []database.Record) (*creator.Creator, error) {
 	return c, nil
 }
 
+func drawLines(c *creator.Creator, lines []string, font *model.PdfFont) error {
+	for _, line := range lines {
+		p := c.NewStyledParagraph()
+		p.Append(line).Style.Font = font
+
+		err := c.Draw(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func addCell(c *creator.Creator, table *creator.Table, text string, font *model.PdfFont) *creator.TableCell {
 	cell := table.NewCell()
 
 	p := c.NewStyledParagraph()
-	p.Append(text).Style.Font = font
+	chunk := p.Append(text)
+	chunk.Style.Font = font
+	chunk.Style.FontSize = 7
 
 	cell.SetContent(p)
 	cell.SetBorder(creator.CellBorderSideAll, creator.CellBorderStyleSingle, 1)
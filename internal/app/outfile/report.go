@@ -0,0 +1,208 @@
+package outfile
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"test_task/internal/app/database"
+)
+
+// columns is a header of the records table in every format
+var columns = []string{"n", "mqtt", "invid", "unit_guid", "msg_id", "text", "context", "class", "level", "area",
+	"addr", "block", "type", "bit", "invert_bit"}
+
+// Report is a content of one output file, records of one unit_guid
+type Report struct {
+	Guid        uuid.UUID
+	InvId       string
+	GeneratedAt time.Time
+	// Files are source files of the records
+	Files []string
+	// Stats are aggregates of Records shown before the records table
+	Stats   database.UnitStats
+	Records []database.Record
+}
+
+// timeFormat is how times are shown in documents
+const timeFormat = "2006-01-02 15:04:05 MST"
+
+// recordNumeric are indexes of integer columns: n, level, bit and invert_bit
+var recordNumeric = []int{0, 8, 13, 14}
+
+// summaryColumns is a header of the statistics table in tabular formats
+var summaryColumns = []string{"group", "value", "records"}
+
+// NewReport returns report of records of the unit matching the filter with their statistics
+// and source files of the unit
+func NewReport(ctx context.Context, db database.IDatabase, guid uuid.UUID, filter database.RecordsFilter) (Report, error) {
+	records, err := db.GetRecordsByFilter(ctx, guid, filter)
+	if err != nil {
+		return Report{}, err
+	}
+
+	stats, err := db.GetUnitStats(ctx, guid, filter)
+	if err != nil {
+		return Report{}, err
+	}
+
+	files, err := db.GetUnitFiles(ctx, guid)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Guid: guid, GeneratedAt: time.Now(), Files: files, Stats: *stats, Records: records}
+	if len(records) > 0 {
+		report.InvId = records[0].InvId
+	}
+
+	return report, nil
+}
+
+// Document returns the report in a form drawn by renderers
+func (r Report) Document() Document {
+	rows := make([][]string, 0, len(r.Records))
+	for _, record := range r.Records {
+		rows = append(rows, recordRow(record))
+	}
+
+	return Document{
+		Name:           r.Guid.String(),
+		Title:          "Unit " + r.Guid.String(),
+		Lines:          titleLines(r),
+		SummaryLines:   summaryLines(r.Stats),
+		SummaryColumns: summaryColumns,
+		SummaryRows:    summaryRows(r.Stats),
+		Columns:        columns,
+		Rows:           rows,
+		Numeric:        recordNumeric,
+	}
+}
+
+// titleLines are lines of a title block above the records table
+func titleLines(report Report) []string {
+	files := make([]string, 0, len(report.Files))
+	for _, file := range report.Files {
+		files = append(files, filepath.Base(file))
+	}
+
+	return []string{
+		"invid: " + report.InvId,
+		"Generated: " + report.GeneratedAt.Format(timeFormat),
+		"Source files: " + strings.Join(files, ", "),
+		"Records: " + strconv.Itoa(len(report.Records)),
+	}
+}
+
+// summaryRows are rows of the statistics table in order of summaryColumns
+func summaryRows(stats database.UnitStats) [][]string {
+	rows := [][]string{{"msg_id", "distinct", strconv.FormatInt(stats.MsgIds, 10)}}
+	for _, group := range summaryGroups(stats) {
+		for _, count := range group.counts {
+			rows = append(rows, []string{group.name, count.Value, strconv.FormatInt(count.Records, 10)})
+		}
+	}
+
+	return rows
+}
+
+// summaryLines are lines of the statistics block in text formats
+func summaryLines(stats database.UnitStats) []string {
+	lines := []string{"Distinct msg_id: " + strconv.FormatInt(stats.MsgIds, 10)}
+	for _, group := range summaryGroups(stats) {
+		counts := make([]string, 0, len(group.counts))
+		for _, count := range group.counts {
+			counts = append(counts, count.Value+" = "+strconv.FormatInt(count.Records, 10))
+		}
+
+		lines = append(lines, "By "+group.name+": "+strings.Join(counts, ", "))
+	}
+
+	return lines
+}
+
+type summaryGroup struct {
+	name   string
+	counts []database.Count
+}
+
+func summaryGroups(stats database.UnitStats) []summaryGroup {
+	return []summaryGroup{
+		{"class", stats.Classes},
+		{"level", stats.Levels},
+		{"area", stats.Areas},
+	}
+}
+
+// Renderer writes document in one output format
+type Renderer interface {
+	// Extension is a file name extension without dot
+	Extension() string
+	Render(w io.Writer, doc Document) error
+}
+
+// recordRow returns cells of the record in order of columns
+func recordRow(record database.Record) []string {
+	return []string{
+		strconv.Itoa(record.N),
+		string(record.MQTT),
+		record.InvId,
+		record.UnitGuid.String(),
+		record.MsgId,
+		record.Text,
+		string(record.Context),
+		record.Class,
+		strconv.Itoa(record.Level),
+		record.Area,
+		record.Addr,
+		record.Block,
+		record.Type,
+		strconv.Itoa(record.Bit),
+		strconv.Itoa(record.InvertBit),
+	}
+}
+
+// columnWidths sizes columns by their widest cell and scales them to fill total width,
+// one column takes at most a quarter of the width and wraps longer text
+func columnWidths(header []string, rows [][]string, total float64, measure func(string) float64) []float64 {
+	widths := make([]float64, len(header))
+	for i, column := range header {
+		widths[i] = measure(column)
+	}
+
+	return fitColumnWidths(widths, rows, total, measure)
+}
+
+// fitColumnWidths is columnWidths for a header already measured in widths
+func fitColumnWidths(widths []float64, rows [][]string, total float64, measure func(string) float64) []float64 {
+	for _, row := range rows {
+		for i, cell := range row {
+			if w := measure(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	sum := 0.0
+	for i := range widths {
+		if widths[i] > total/4 {
+			widths[i] = total / 4
+		}
+		sum += widths[i]
+	}
+
+	for i := range widths {
+		if sum == 0 {
+			widths[i] = total / float64(len(widths))
+			continue
+		}
+		widths[i] = widths[i] * total / sum
+	}
+
+	return widths
+}
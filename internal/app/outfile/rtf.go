@@ -0,0 +1,113 @@
+package outfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"test_task/internal/app/config"
+)
+
+// rtf sizes are in twips, 1/1440 of inch
+const (
+	rtfPageWidth  = 16838
+	rtfPageHeight = 11906
+	rtfMargin     = 567
+)
+
+type rtfRenderer struct{}
+
+func newRTFRenderer(cfg config.OutFile) (Renderer, error) {
+	return &rtfRenderer{}, nil
+}
+
+func (r *rtfRenderer) Extension() string {
+	return "rtf"
+}
+
+func (r *rtfRenderer) Render(w io.Writer, doc Document) error {
+	out := bufio.NewWriter(w)
+
+	// landscape A4 with small font, so that 15 columns fit the page width
+	fmt.Fprintf(out, `{\rtf1\ansi\ansicpg1251\deff0{\fonttbl{\f0\fswiss\fcharset204 Arial;}}`+
+		`\paperw%d\paperh%d\margl%[3]d\margr%[3]d\margt%[3]d\margb%[3]d\landscape\fs14`+"\n",
+		rtfPageWidth, rtfPageHeight, rtfMargin)
+
+	out.WriteString(`{\b\fs24 ` + rtfEscape(doc.Title) + `}\par` + "\n")
+	for _, line := range doc.Lines {
+		out.WriteString(rtfEscape(line) + `\par` + "\n")
+	}
+	out.WriteString(`\par` + "\n")
+
+	if len(doc.SummaryLines) > 0 {
+		out.WriteString(`{\b Summary}\par` + "\n")
+		for _, line := range doc.SummaryLines {
+			out.WriteString(rtfEscape(line) + `\par` + "\n")
+		}
+		out.WriteString(`\par` + "\n")
+	}
+
+	writeRTFRow(out, doc.Columns, true)
+	for _, row := range doc.Rows {
+		writeRTFRow(out, row, false)
+	}
+
+	out.WriteString("}\n")
+
+	return out.Flush()
+}
+
+func writeRTFRow(out *bufio.Writer, cells []string, header bool) {
+	out.WriteString(`\trowd\trgaph40`)
+	if header {
+		// header row is repeated on every page
+		out.WriteString(`\trhdr`)
+	}
+
+	cellWidth := (rtfPageWidth - 2*rtfMargin) / len(cells)
+	for i := range cells {
+		fmt.Fprintf(out, `\clbrdrt\brdrs\clbrdrl\brdrs\clbrdrb\brdrs\clbrdrr\brdrs\cellx%d`, cellWidth*(i+1))
+	}
+
+	for _, cell := range cells {
+		out.WriteString(`\pard\intbl `)
+		if header {
+			out.WriteString(`\b `)
+		}
+		out.WriteString(rtfEscape(cell))
+		if header {
+			out.WriteString(`\b0`)
+		}
+		out.WriteString(`\cell`)
+	}
+
+	out.WriteString("\\row\n")
+}
+
+// rtfEscape escapes control characters of RTF and writes non-ASCII characters as \u escapes
+func rtfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '{' || r == '}':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\line `)
+		case r < 0x20:
+			// other control characters are not printable
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xffff:
+			// \u takes signed 16-bit value, ? is shown by readers without unicode support
+			fmt.Fprintf(&b, `\u%d?`, int16(r))
+		default:
+			// characters outside of BMP are written as UTF-16 surrogate pair
+			r -= 0x10000
+			fmt.Fprintf(&b, `\u%d?\u%d?`, int16(0xd800+(r>>10)), int16(0xdc00+(r&0x3ff)))
+		}
+	}
+
+	return b.String()
+}
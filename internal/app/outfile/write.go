@@ -0,0 +1,112 @@
+package outfile
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// versionTimeFormat is a timestamp in names of file versions, it sorts in time order
+const versionTimeFormat = "20060102T150405"
+
+// writeFile replaces the file atomically, readers see either the old or the complete new content
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Chmod(0644)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeVersion writes <name>.<extension> in place or, when versions are kept,
+// writes <name>.<timestamp>.<extension> and points <name>.<extension> symlink to it
+func (f *Files) writeVersion(name string, extension string, generatedAt time.Time, data []byte) error {
+	latest := f.latestPath(name, extension)
+	if f.keepVersions <= 0 {
+		return writeFile(latest, data)
+	}
+
+	version := name + "." + generatedAt.UTC().Format(versionTimeFormat) + "." + extension
+	err := writeFile(filepath.Join(f.outFilesDir, version), data)
+	if err != nil {
+		return err
+	}
+
+	err = replaceSymlink(version, latest)
+	if err != nil {
+		return err
+	}
+
+	return f.pruneVersions(name, extension)
+}
+
+// latestPath is the path readers open, a file or a symlink to the latest version
+func (f *Files) latestPath(name string, extension string) string {
+	return filepath.Join(f.outFilesDir, name+"."+extension)
+}
+
+// replaceSymlink points link to target, the link is never missing while it is replaced.
+// The new link is created under a unique name, so concurrent calls do not take each other's link
+func replaceSymlink(target string, link string) error {
+	var tmp string
+	for {
+		tmp = link + "." + strconv.FormatUint(uint64(rand.Uint32()), 10) + ".tmp"
+		err := os.Symlink(target, tmp)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+
+	err := os.Rename(tmp, link)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// pruneVersions removes all but the newest versions of the file
+func (f *Files) pruneVersions(name string, extension string) error {
+	versions, err := filepath.Glob(filepath.Join(f.outFilesDir, name+".*."+extension))
+	if err != nil {
+		return err
+	}
+	if len(versions) <= f.keepVersions {
+		return nil
+	}
+
+	sort.Strings(versions)
+	for _, version := range versions[:len(versions)-f.keepVersions] {
+		err = os.Remove(version)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
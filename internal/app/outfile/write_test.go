@@ -0,0 +1,48 @@
+package outfile
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReplaceSymlinkConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "unit.csv")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- replaceSymlink("unit.20240101T000000.csv", link)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent replaceSymlink: %v", err)
+		}
+	}
+
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "unit.20240101T000000.csv" {
+		t.Fatalf("link points to %s", target)
+	}
+
+	// temporary links are renamed over the link, none are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory has %d entries, want only the link", len(entries))
+	}
+}
@@ -0,0 +1,152 @@
+package outfile
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+
+	"test_task/internal/app/config"
+)
+
+const (
+	xlsxSheet        = "Sheet1"
+	xlsxSummarySheet = "Summary"
+)
+
+type xlsxRenderer struct{}
+
+func newXLSXRenderer(cfg config.OutFile) (Renderer, error) {
+	return &xlsxRenderer{}, nil
+}
+
+func (r *xlsxRenderer) Extension() string {
+	return "xlsx"
+}
+
+func (r *xlsxRenderer) Render(w io.Writer, doc Document) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := doc.Name
+	// sheet names are limited to 31 characters
+	if len(sheet) > 31 {
+		sheet = sheet[:31]
+	}
+
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	// statistics are on the first sheet, the table on the second one
+	if len(doc.SummaryRows) > 0 {
+		err = f.SetSheetName(xlsxSheet, xlsxSummarySheet)
+		if err != nil {
+			return err
+		}
+
+		err = writeXLSXSummary(f, doc, bold)
+		if err != nil {
+			return err
+		}
+
+		_, err = f.NewSheet(sheet)
+	} else {
+		err = f.SetSheetName(xlsxSheet, sheet)
+	}
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, 0, len(doc.Columns))
+	for _, column := range doc.Columns {
+		header = append(header, column)
+	}
+
+	err = setRow(f, sheet, 1, header)
+	if err != nil {
+		return err
+	}
+	err = f.SetRowStyle(sheet, 1, 1, bold)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range doc.Rows {
+		err = setRow(f, sheet, i+2, rowValues(doc, row))
+		if err != nil {
+			return err
+		}
+	}
+
+	// header stays visible while scrolling
+	err = f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return err
+	}
+
+	return f.Write(w)
+}
+
+func writeXLSXSummary(f *excelize.File, doc Document, bold int) error {
+	header := make([]interface{}, 0, len(doc.SummaryColumns))
+	for _, column := range doc.SummaryColumns {
+		header = append(header, column)
+	}
+
+	err := setRow(f, xlsxSummarySheet, 1, header)
+	if err != nil {
+		return err
+	}
+	err = f.SetRowStyle(xlsxSummarySheet, 1, 1, bold)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range doc.SummaryRows {
+		values := make([]interface{}, 0, len(row))
+		for _, cell := range row {
+			values = append(values, cell)
+		}
+
+		// counts are the last column, they are kept as numbers
+		last := len(row) - 1
+		if n, err := strconv.ParseInt(row[last], 10, 64); err == nil {
+			values[last] = n
+		}
+
+		err = setRow(f, xlsxSummarySheet, i+2, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setRow(f *excelize.File, sheet string, row int, values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, row)
+	if err != nil {
+		return err
+	}
+
+	return f.SetSheetRow(sheet, cell, &values)
+}
+
+// rowValues keeps numeric columns as numbers, so analysts can filter and sum them
+func rowValues(doc Document, row []string) []interface{} {
+	values := make([]interface{}, 0, len(row))
+	for i, cell := range row {
+		if doc.isNumeric(i) {
+			if n, err := strconv.Atoi(cell); err == nil {
+				values = append(values, n)
+				continue
+			}
+		}
+
+		values = append(values, cell)
+	}
+
+	return values
+}
@@ -7,33 +7,76 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gofrs/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"test_task/internal/app/broadcast"
 	"test_task/internal/app/config"
 	"test_task/internal/app/database"
+	"test_task/internal/app/directory"
+	"test_task/internal/app/metrics"
 	"test_task/internal/app/outfile"
+	"test_task/internal/app/tracing"
+	"test_task/internal/app/validation"
 )
 
+// columns are names of columns in order of the file, they are used in errors and validation rules
+var columns = []string{"n", "mqtt", "invid", "unit_guid", "msg_id", "text", "context", "class",
+	"level", "area", "addr", "block", "type", "bit", "invert_bit"}
+
+var numericColumns = []string{"n", "level", "bit", "invert_bit"}
+
+// defaultRules keep garbage out of the database when VALIDATION_RULES_FILE is not set,
+// the file replaces them column by column
+var defaultRules = map[string]validation.Rule{
+	"invid":      {Required: true},
+	"unit_guid":  {Required: true},
+	"msg_id":     {Required: true},
+	"class":      {Required: true, Allowed: []string{"alarm", "warning", "working", "waiting"}},
+	"level":      {Min: intPtr(0), Max: intPtr(100)},
+	"bit":        {Min: intPtr(0), Max: intPtr(31)},
+	"invert_bit": {Min: intPtr(0), Max: intPtr(1)},
+	"addr":       {Required: true, Pattern: `[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*`},
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+var columnsCount = len(columns)
+
+var tracer = otel.Tracer("test_task/internal/app/parser")
+
 type Parser struct {
-	queue       chan string
+	queue       chan directory.QueuedFile
 	db          database.IDatabase
-	outFilesDir string
 	outFile     outfile.IOutFile
+	broadcaster broadcast.IBroadcaster
+	validator   *validation.Validator
 
 	errChan chan error
 }
 
-func New(cfg config.Parser, queue chan string, errChan chan error, db database.IDatabase) (*Parser, error) {
+func New(cfg config.Parser, queue chan directory.QueuedFile, errChan chan error, db database.IDatabase, broadcaster broadcast.IBroadcaster) (*Parser, error) {
 	par := Parser{}
 
 	par.queue = queue
 	par.errChan = errChan
 	par.db = db
-	par.outFilesDir = cfg.OutFilesDirectory
+	par.broadcaster = broadcaster
 
 	var err error
-	par.outFile, err = outfile.New(par.outFilesDir, par.db)
+	par.validator, err = validation.New(cfg.RulesFile, columns, numericColumns, defaultRules)
+	if err != nil {
+		return nil, err
+	}
+
+	par.outFile, err = outfile.New(cfg.OutFile, par.db, errChan)
 	if err != nil {
 		return nil, err
 	}
@@ -41,40 +84,115 @@ func New(cfg config.Parser, queue chan string, errChan chan error, db database.I
 	return &par, nil
 }
 
+// Run parses queued files until ctx is cancelled, output files are flushed after the last parsed file
 func (p *Parser) Run(ctx context.Context) {
+	outCtx, stopOutFile := context.WithCancel(context.Background())
+	go p.outFile.Run(outCtx)
+
 	for {
-		file := <-p.queue
-		tsvData, err := p.readTSVFile(file)
-		if err != nil {
-			p.errChan <- errors.Errorf("read tsv file error: %e", err)
-			continue
+		select {
+		case <-ctx.Done():
+			stopOutFile()
+			return
+		case file := <-p.queue:
+			// a file being parsed on shutdown is finished, so it is not left processing in the ledger
+			p.processFile(trace.ContextWithRemoteSpanContext(context.Background(), file.Span), file.Path)
 		}
+	}
+}
 
-		records, err := p.parseTSV(tsvData)
-		if err != nil {
-			p.errChan <- errors.Errorf("parse tsv file error: %e", err)
-		}
+// Done is closed when output files are flushed after Run returned
+func (p *Parser) Done() <-chan struct{} {
+	return p.outFile.Done()
+}
 
-		err = p.db.AddDataRow(ctx, records)
-		if err != nil {
-			p.errChan <- errors.Errorf("add data to database error: %e", err)
-		}
+func (p *Parser) processFile(ctx context.Context, file string) {
+	ctx, span := tracer.Start(ctx, "Parser.processFile", trace.WithAttributes(attribute.String("file", file)))
+	defer span.End()
+
+	fileInfo := database.File{Name: file, Status: database.FileProcessing}
+	p.updateFile(ctx, &fileInfo)
+
+	tsvData, err := p.readTSVFile(ctx, file)
+	if err != nil {
+		p.errChan <- errors.Errorf("read tsv file error: %e", err)
+		tracing.RecordError(span, err)
+		p.failFile(ctx, &fileInfo, err)
+		return
+	}
 
-		err = p.WriteDataToFile(ctx, records)
+	records, rowErrors := p.parseTSV(ctx, tsvData)
+	metrics.RowsParsed.Add(float64(len(records)))
+	fileInfo.RowsParsed = len(records)
+	fileInfo.RowsRejected = len(rowErrors)
+	fileInfo.RowsTotal = fileInfo.RowsParsed + fileInfo.RowsRejected
+
+	if len(rowErrors) > 0 {
+		p.errChan <- errors.Errorf("parse tsv file %s: %d rows rejected", file, len(rowErrors))
+
+		err = p.db.AddFileErrors(ctx, file, rowErrors)
 		if err != nil {
-			p.errChan <- errors.Errorf("write to out file error: %e", err)
+			p.errChan <- errors.Errorf("add file errors to database error: %v", err)
 		}
 	}
+
+	insertStart := time.Now()
+	err = p.db.AddDataRow(ctx, file, records)
+	metrics.Since(metrics.DBInsertDuration, insertStart)
+	if err != nil {
+		p.errChan <- errors.Errorf("add data to database error: %e", err)
+		tracing.RecordError(span, err)
+		p.failFile(ctx, &fileInfo, err)
+		return
+	}
+
+	err = p.broadcaster.Publish(ctx, file, records)
+	if err != nil {
+		p.errChan <- errors.Errorf("publish new records error: %v", err)
+	}
+
+	err = p.WriteDataToFile(ctx, records)
+	if err != nil {
+		p.errChan <- errors.Errorf("write to out file error: %e", err)
+	}
+
+	fileInfo.Status = database.FileProcessed
+	p.updateFile(ctx, &fileInfo)
+	metrics.FilesProcessed.Inc()
+}
+
+func (p *Parser) failFile(ctx context.Context, fileInfo *database.File, err error) {
+	metrics.FilesFailed.Inc()
+
+	fileInfo.Status = database.FileFailed
+	fileInfo.Error = err.Error()
+	p.updateFile(ctx, fileInfo)
 }
 
-func (p *Parser) readTSVFile(path string) (*[][]string, error) {
+func (p *Parser) updateFile(ctx context.Context, fileInfo *database.File) {
+	if fileInfo.Status != database.FileProcessing {
+		now := time.Now()
+		fileInfo.ProcessedAt = &now
+	}
+
+	err := p.db.UpdateFile(ctx, *fileInfo)
+	if err != nil {
+		p.errChan <- errors.Errorf("update file status error: %v", err)
+	}
+}
+
+func (p *Parser) readTSVFile(ctx context.Context, path string) (*[][]string, error) {
+	_, span := tracer.Start(ctx, "Parser.readTSVFile")
+	defer span.End()
+
 	tsvFile, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 
 	r := csv.NewReader(tsvFile)
-	r.Comma = '\t' // Use tab-delimited instead of comma
+	r.Comma = '\t'         // Use tab-delimited instead of comma
+	r.FieldsPerRecord = -1 // Wrong rows are rejected by parseRow, not the whole file
 
 	tsvData, err := r.ReadAll()
 	if err != nil {
@@ -89,60 +207,150 @@ func (p *Parser) readTSVFile(path string) (*[][]string, error) {
 	return &tsvData, nil
 }
 
-func (p *Parser) parseTSV(tsvData *[][]string) ([]database.Record, error) {
-	var allRecords []database.Record
-	var err error
+// parseTSV skips the header row and returns rejected rows separately from parsed ones
+func (p *Parser) parseTSV(ctx context.Context, tsvData *[][]string) ([]database.Record, []database.FileError) {
+	_, span := tracer.Start(ctx, "Parser.parseTSV")
+	defer span.End()
 
-	for _, row := range *tsvData {
-		var oneRecord database.Record
+	var allRecords []database.Record
+	var rowErrors []database.FileError
 
-		oneRecord.N, err = readInt(row[0])
-		if err != nil {
-			p.errChan <- err
+	for i, row := range *tsvData {
+		if i == 0 && isHeader(row) {
 			continue
 		}
 
-		oneRecord.MQTT, _ = readBytes(row[1])
-		oneRecord.InvId, _ = readString(row[2])
-
-		oneRecord.UnitGuid, err = uuid.FromString(row[3])
+		oneRecord, err := parseRow(row)
+		if err == nil {
+			// rules are checked only for rows with right types, so that one row has errors of one kind
+			err = p.validator.Validate(row)
+		}
 		if err != nil {
-			p.errChan <- err
+			for _, column := range errorColumns(err) {
+				metrics.RowsRejected.WithLabelValues(column).Inc()
+			}
+			rowErrors = append(rowErrors, database.FileError{Line: i + 1, Error: err.Error()})
 			continue
 		}
 
-		oneRecord.MsgId, _ = readString(row[4])
-		oneRecord.Text, _ = readString(row[5])
-		oneRecord.Context, _ = readBytes(row[6])
-		oneRecord.Class, _ = readString(row[7])
+		allRecords = append(allRecords, oneRecord)
+	}
 
-		oneRecord.Level, err = readInt(row[8])
-		if err != nil {
-			p.errChan <- err
-			continue
-		}
+	span.SetAttributes(attribute.Int("rows.parsed", len(allRecords)), attribute.Int("rows.rejected", len(rowErrors)))
 
-		oneRecord.Area, _ = readString(row[9])
-		oneRecord.Addr, _ = readString(row[10])
-		oneRecord.Block, _ = readString(row[11])
-		oneRecord.Type, _ = readString(row[12])
+	return allRecords, rowErrors
+}
 
-		oneRecord.Bit, err = readInt(row[13])
-		if err != nil {
-			p.errChan <- err
-			continue
-		}
+// columnError tells which column of the row could not be parsed
+type columnError struct {
+	column string
+	err    error
+}
 
-		oneRecord.InvertBit, err = readInt(row[14])
-		if err != nil {
-			p.errChan <- err
-			continue
-		}
+func (e *columnError) Error() string {
+	return e.column + ": " + e.err.Error()
+}
 
-		allRecords = append(allRecords, oneRecord)
+// errorColumns returns columns of the rejected row, a row failing validation may have several
+func errorColumns(err error) []string {
+	switch err := err.(type) {
+	case *columnError:
+		return []string{err.column}
+	case validation.Errors:
+		return err.Fields()
 	}
 
-	return allRecords, nil
+	return []string{"unknown"}
+}
+
+func isHeader(row []string) bool {
+	return len(row) > 0 && strings.TrimSpace(row[0]) == "n"
+}
+
+func parseRow(row []string) (database.Record, error) {
+	var oneRecord database.Record
+	var err error
+
+	if len(row) != columnsCount {
+		return oneRecord, &columnError{"columns", errors.Errorf("expected %d columns, got %d", columnsCount, len(row))}
+	}
+
+	oneRecord.N, err = readInt(row[0])
+	if err != nil {
+		return oneRecord, &columnError{"n", err}
+	}
+
+	oneRecord.MQTT, err = readBytes(row[1])
+	if err != nil {
+		return oneRecord, &columnError{"mqtt", err}
+	}
+
+	oneRecord.InvId, err = readString(row[2])
+	if err != nil {
+		return oneRecord, &columnError{"invid", err}
+	}
+
+	oneRecord.UnitGuid, err = uuid.FromString(strings.TrimSpace(row[3]))
+	if err != nil {
+		return oneRecord, &columnError{"unit_guid", err}
+	}
+
+	oneRecord.MsgId, err = readString(row[4])
+	if err != nil {
+		return oneRecord, &columnError{"msg_id", err}
+	}
+
+	oneRecord.Text, err = readString(row[5])
+	if err != nil {
+		return oneRecord, &columnError{"text", err}
+	}
+
+	oneRecord.Context, err = readBytes(row[6])
+	if err != nil {
+		return oneRecord, &columnError{"context", err}
+	}
+
+	oneRecord.Class, err = readString(row[7])
+	if err != nil {
+		return oneRecord, &columnError{"class", err}
+	}
+
+	oneRecord.Level, err = readInt(row[8])
+	if err != nil {
+		return oneRecord, &columnError{"level", err}
+	}
+
+	oneRecord.Area, err = readString(row[9])
+	if err != nil {
+		return oneRecord, &columnError{"area", err}
+	}
+
+	oneRecord.Addr, err = readString(row[10])
+	if err != nil {
+		return oneRecord, &columnError{"addr", err}
+	}
+
+	oneRecord.Block, err = readString(row[11])
+	if err != nil {
+		return oneRecord, &columnError{"block", err}
+	}
+
+	oneRecord.Type, err = readString(row[12])
+	if err != nil {
+		return oneRecord, &columnError{"type", err}
+	}
+
+	oneRecord.Bit, err = readInt(row[13])
+	if err != nil {
+		return oneRecord, &columnError{"bit", err}
+	}
+
+	oneRecord.InvertBit, err = readInt(row[14])
+	if err != nil {
+		return oneRecord, &columnError{"invert_bit", err}
+	}
+
+	return oneRecord, nil
 }
 
 func (p *Parser) WriteDataToFile(ctx context.Context, records []database.Record) error {
@@ -171,12 +379,18 @@ func readInt(str string) (int, error) {
 
 func readString(str string) (string, error) {
 	str = strings.TrimSpace(str)
+	if !utf8.ValidString(str) {
+		return "", errors.New("invalid UTF-8")
+	}
 
 	return str, nil
 }
 
 func readBytes(str string) ([]byte, error) {
 	str = strings.TrimSpace(str)
+	if strings.ContainsRune(str, 0) {
+		return nil, errors.New("contains NUL character")
+	}
 
 	return []byte(str), nil
 }
@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"test_task/internal/app/database"
+	"test_task/internal/app/validation"
+)
+
+const testGuid = "01749246-95f6-57db-b7c3-2ae0e8be671f"
+
+// testRow is a valid row with cells replaced by column name
+func testRow(cells map[string]string) []string {
+	row := []string{"1", " ", "G-044322", testGuid, "cold7_Defrost_status", "Разморозка ", "", "waiting", "100",
+		"LOCAL", "cold7_status.Defrost_status", "", "", "3", "1"}
+	for i, column := range columns {
+		if cell, ok := cells[column]; ok {
+			row[i] = cell
+		}
+	}
+
+	return row
+}
+
+func TestParseRow(t *testing.T) {
+	tests := []struct {
+		name   string
+		row    []string
+		column string
+		want   database.Record
+	}{
+		{
+			name: "valid row",
+			row:  testRow(nil),
+			want: database.Record{N: 1, MQTT: []byte{}, InvId: "G-044322", UnitGuid: uuid.FromStringOrNil(testGuid),
+				MsgId: "cold7_Defrost_status", Text: "Разморозка", Context: []byte{}, Class: "waiting", Level: 100,
+				Area: "LOCAL", Addr: "cold7_status.Defrost_status", Bit: 3, InvertBit: 1},
+		},
+		{name: "too few columns", row: testRow(nil)[:14], column: "columns"},
+		{name: "n is not integer", row: testRow(map[string]string{"n": "one"}), column: "n"},
+		{name: "invalid guid", row: testRow(map[string]string{"unit_guid": "0174"}), column: "unit_guid"},
+		{name: "invalid utf-8", row: testRow(map[string]string{"text": "\xff\xfe"}), column: "text"},
+		{name: "NUL in context", row: testRow(map[string]string{"context": "a\x00b"}), column: "context"},
+		{name: "level is not integer", row: testRow(map[string]string{"level": "high"}), column: "level"},
+		{name: "bit is not integer", row: testRow(map[string]string{"bit": "1.5"}), column: "bit"},
+		{name: "invert_bit is not integer", row: testRow(map[string]string{"invert_bit": "yes"}), column: "invert_bit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := parseRow(tt.row)
+			if tt.column != "" {
+				colErr, ok := err.(*columnError)
+				if !ok || colErr.column != tt.column {
+					t.Fatalf("parseRow error = %v, want error of %s", err, tt.column)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(record, tt.want) {
+				t.Fatalf("parseRow = %+v, want %+v", record, tt.want)
+			}
+		})
+	}
+}
+
+func newTestParser(t *testing.T) *Parser {
+	t.Helper()
+
+	v, err := validation.New("", columns, numericColumns, defaultRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Parser{validator: v}
+}
+
+func TestParseTSVDefaultRules(t *testing.T) {
+	p := newTestParser(t)
+
+	header := strings.Split("n\tmqtt\tinvid\tunit_guid\tmsg_id\ttext\tcontext\tclass\tlevel\tarea\taddr\tblock\ttype\tbit\tinvert_bit", "\t")
+	data := [][]string{
+		header,
+		testRow(nil),
+		testRow(map[string]string{"class": "bogus", "bit": "32", "invert_bit": "2"}),
+		testRow(map[string]string{"addr": "bad addr", "level": "-1"}),
+		testRow(map[string]string{"invid": " ", "level": "x"}),
+	}
+
+	records, rowErrors := p.parseTSV(context.Background(), &data)
+	if len(records) != 1 {
+		t.Fatalf("parsed %d records, want 1", len(records))
+	}
+
+	want := []database.FileError{
+		{Line: 3, Error: `class: "bogus" is not one of alarm, warning, working, waiting; bit: 32 is out of range 0..31; ` +
+			`invert_bit: 2 is out of range 0..1`},
+		{Line: 4, Error: `level: -1 is out of range 0..100; addr: "bad addr" does not match [A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*`},
+		// rules are checked only when types are right
+		{Line: 5, Error: `level: strconv.Atoi: parsing "x": invalid syntax`},
+	}
+	if !reflect.DeepEqual(rowErrors, want) {
+		t.Fatalf("row errors = %+v, want %+v", rowErrors, want)
+	}
+}
+
+func TestErrorColumns(t *testing.T) {
+	p := newTestParser(t)
+
+	err := p.validator.Validate(testRow(map[string]string{"class": "", "bit": "40"}))
+	got := errorColumns(err)
+	if !reflect.DeepEqual(got, []string{"class", "bit"}) {
+		t.Fatalf("errorColumns(%v) = %v, want [class bit]", err, got)
+	}
+
+	_, err = parseRow(testRow(map[string]string{"n": "x"}))
+	if got = errorColumns(err); !reflect.DeepEqual(got, []string{"n"}) {
+		t.Fatalf("errorColumns(%v) = %v, want [n]", err, got)
+	}
+}
+
+func TestSampleFilePassesDefaultRules(t *testing.T) {
+	p := newTestParser(t)
+	ctx := context.Background()
+
+	data, err := p.readTSVFile(ctx, "../../../tsv/integratsiiapparatnyhpl.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, rowErrors := p.parseTSV(ctx, data)
+	if len(rowErrors) > 0 || len(records) == 0 {
+		t.Fatalf("sample file: %d records, rejected rows %+v", len(records), rowErrors)
+	}
+}
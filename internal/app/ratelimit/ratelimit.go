@@ -0,0 +1,237 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"test_task/internal/app/auth"
+	"test_task/internal/app/config"
+)
+
+// pageRequest is implemented by generated request messages with page limit
+type pageRequest interface {
+	GetLimit() int32
+}
+
+type batchRequest interface {
+	GetBatchSize() int32
+}
+
+// bucketIdleTimeout is how long an unused bucket is kept, it is full again by then,
+// so a new bucket of the same caller behaves the same
+const bucketIdleTimeout = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// Limiter keeps a token bucket per client and rejects pages larger than the
+// client may request. It must run after the auth interceptor
+type Limiter struct {
+	rps         float64
+	burst       int
+	maxPageSize int32
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(cfg config.RateLimit) (*Limiter, error) {
+	l := &Limiter{}
+
+	l.rps = cfg.RPS
+	l.burst = cfg.Burst
+	l.maxPageSize = cfg.MaxPageSize
+	l.buckets = make(map[string]*bucket)
+	l.lastSweep = time.Now()
+
+	return l, nil
+}
+
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if auth.IsPublic(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		identity := auth.FromContext(ctx)
+
+		err := l.allow(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+
+		err = l.checkPageSize(identity, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if auth.IsPublic(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		identity := auth.FromContext(ss.Context())
+
+		err := l.allow(ss.Context(), identity)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &pageStream{ServerStream: ss, limiter: l, identity: identity})
+	}
+}
+
+func (l *Limiter) allow(ctx context.Context, identity *auth.Identity) error {
+	limiter := l.bucket(bucketKey(ctx, identity), identity)
+
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+	reservation.Cancel()
+
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+
+	return st.Err()
+}
+
+// bucketKey is the client name, anonymous callers are told apart by their address
+// so that they do not share one bucket. Requests of the gateway come from one peer,
+// their address is the last x-forwarded-for entry, which the gateway appends itself
+func bucketKey(ctx context.Context, identity *auth.Identity) string {
+	if identity != nil && identity.Name != auth.Anonymous {
+		return identity.Name
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if forwarded := md.Get("x-forwarded-for"); len(forwarded) > 0 {
+		hosts := strings.Split(forwarded[len(forwarded)-1], ",")
+		if host := strings.TrimSpace(hosts[len(hosts)-1]); host != "" {
+			return auth.Anonymous + "@" + host
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return auth.Anonymous
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	return auth.Anonymous + "@" + host
+}
+
+func (l *Limiter) bucket(key string, identity *auth.Identity) *rate.Limiter {
+	rps, burst := l.rps, l.burst
+	if identity != nil {
+		if identity.RateLimit > 0 {
+			rps = identity.RateLimit
+		}
+		if identity.Burst > 0 {
+			burst = identity.Burst
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		limit := rate.Limit(rps)
+		if rps <= 0 {
+			limit = rate.Inf
+		}
+
+		b = &bucket{limiter: rate.NewLimiter(limit, burst)}
+		l.buckets[key] = b
+	}
+	b.lastUsed = now
+
+	return b.limiter
+}
+
+// sweep removes buckets of callers gone for bucketIdleTimeout, otherwise every
+// anonymous address would stay in memory forever
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastUsed) >= bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) checkPageSize(identity *auth.Identity, req interface{}) error {
+	maxPageSize := l.maxPageSize
+	if identity != nil && identity.MaxPageSize > 0 {
+		maxPageSize = identity.MaxPageSize
+	}
+	if maxPageSize <= 0 {
+		return nil
+	}
+
+	var size int32
+	switch r := req.(type) {
+	case pageRequest:
+		size = r.GetLimit()
+	case batchRequest:
+		size = r.GetBatchSize()
+	default:
+		return nil
+	}
+
+	if size > maxPageSize {
+		return status.Errorf(codes.InvalidArgument, "page size %d exceeds maximum %d", size, maxPageSize)
+	}
+
+	return nil
+}
+
+// pageStream checks page size of the messages received from the client
+type pageStream struct {
+	grpc.ServerStream
+	limiter  *Limiter
+	identity *auth.Identity
+}
+
+func (s *pageStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	return s.limiter.checkPageSize(s.identity, m)
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"test_task/internal/app/auth"
+	"test_task/internal/app/config"
+)
+
+func peerContext(addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+}
+
+func TestAnonymousCallersHaveOwnBuckets(t *testing.T) {
+	l, err := New(config.RateLimit{RPS: 1, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := &auth.Identity{Client: auth.Client{Name: auth.Anonymous}}
+
+	err = l.allow(peerContext("10.0.0.1:5000"), anonymous)
+	if err != nil {
+		t.Fatalf("first request of 10.0.0.1: %v", err)
+	}
+
+	// another connection of the same host shares its bucket
+	err = l.allow(peerContext("10.0.0.1:5001"), anonymous)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second request of 10.0.0.1 = %v, want ResourceExhausted", err)
+	}
+
+	err = l.allow(peerContext("10.0.0.2:5000"), anonymous)
+	if err != nil {
+		t.Fatalf("first request of 10.0.0.2: %v", err)
+	}
+}
+
+func TestClientsAreKeyedByName(t *testing.T) {
+	l, err := New(config.RateLimit{RPS: 1, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &auth.Identity{Client: auth.Client{Name: "ops"}}
+
+	err = l.allow(peerContext("10.0.0.1:5000"), client)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	err = l.allow(peerContext("10.0.0.2:5000"), client)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("request from another address = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestGatewayCallersAreKeyedByForwardedAddress(t *testing.T) {
+	l, err := New(config.RateLimit{RPS: 1, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := &auth.Identity{Client: auth.Client{Name: auth.Anonymous}}
+
+	// every gateway request comes from the address of the gateway
+	forwarded := func(xff string) context.Context {
+		return metadata.NewIncomingContext(peerContext("10.0.0.9:5000"), metadata.Pairs("x-forwarded-for", xff))
+	}
+
+	err = l.allow(forwarded("192.0.2.1"), anonymous)
+	if err != nil {
+		t.Fatalf("first request of 192.0.2.1: %v", err)
+	}
+
+	err = l.allow(forwarded("192.0.2.2"), anonymous)
+	if err != nil {
+		t.Fatalf("first request of 192.0.2.2: %v", err)
+	}
+
+	// the gateway appends the address it sees to the one sent by the caller
+	err = l.allow(forwarded("198.51.100.7, 192.0.2.1"), anonymous)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second request of 192.0.2.1 = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestIdleBucketsAreEvicted(t *testing.T) {
+	l, err := New(config.RateLimit{RPS: 1, Burst: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := &auth.Identity{Client: auth.Client{Name: auth.Anonymous}}
+
+	err = l.allow(peerContext("10.0.0.1:5000"), anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend the caller has been gone for a while
+	l.lastSweep = l.lastSweep.Add(-bucketIdleTimeout)
+	for _, b := range l.buckets {
+		b.lastUsed = b.lastUsed.Add(-bucketIdleTimeout)
+	}
+
+	err = l.allow(peerContext("10.0.0.2:5000"), anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.buckets[auth.Anonymous+"@10.0.0.1"]; ok {
+		t.Fatal("bucket of 10.0.0.1 is kept after it was idle")
+	}
+	if len(l.buckets) != 1 {
+		t.Fatalf("%d buckets are kept, want only the active one", len(l.buckets))
+	}
+}
@@ -0,0 +1,153 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+)
+
+// aheadMonths is how many months of partitions exist in advance including the current one
+const aheadMonths = 3
+
+// Partitioner is implemented by databases which keep data in monthly partitions
+type Partitioner interface {
+	CreatePartitions(ctx context.Context, from time.Time, months int) error
+	ListPartitions(ctx context.Context) ([]database.Partition, error)
+	ArchivePartition(ctx context.Context, name string, w io.Writer) error
+	DropPartition(ctx context.Context, name string) error
+}
+
+// Retention creates partitions of data for next months and drops partitions
+// older than the configured number of months, archiving them beforehand
+type Retention struct {
+	db Partitioner
+
+	months           int
+	archiveDirectory string
+	interval         time.Duration
+
+	errChan chan error
+}
+
+func New(ctx context.Context, cfg config.Retention, db database.IDatabase, errChan chan error) (*Retention, error) {
+	partitioner, ok := db.(Partitioner)
+	if !ok {
+		return nil, errors.New("database does not support partitioning")
+	}
+
+	r := &Retention{}
+
+	r.db = partitioner
+	r.months = cfg.Months
+	r.archiveDirectory = cfg.ArchiveDirectory
+	r.interval = cfg.Interval
+	r.errChan = errChan
+
+	if r.archiveDirectory != "" {
+		err := os.MkdirAll(r.archiveDirectory, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// partition of the current month must exist before the parser inserts anything
+	err := r.db.CreatePartitions(ctx, time.Now(), aheadMonths)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		err := r.db.CreatePartitions(ctx, time.Now(), aheadMonths)
+		if err != nil {
+			r.errChan <- errors.Errorf("create partitions error: %v", err)
+		}
+
+		if r.months > 0 {
+			err = r.dropExpired(ctx)
+			if err != nil {
+				r.errChan <- errors.Errorf("retention error: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Retention) dropExpired(ctx context.Context) error {
+	partitions, err := r.db.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := database.MonthStart(time.Now()).AddDate(0, -r.months, 0)
+
+	for _, partition := range partitions {
+		if partition.To.After(cutoff) {
+			continue
+		}
+
+		if r.archiveDirectory != "" {
+			err = r.archive(ctx, partition.Name)
+			if err != nil {
+				return errors.Wrapf(err, "archive partition %s", partition.Name)
+			}
+		}
+
+		err = r.db.DropPartition(ctx, partition.Name)
+		if err != nil {
+			return errors.Wrapf(err, "drop partition %s", partition.Name)
+		}
+	}
+
+	return nil
+}
+
+// archive writes partition to <name>.tsv.gz, the file appears only when it is complete
+func (r *Retention) archive(ctx context.Context, name string) error {
+	path := filepath.Join(r.archiveDirectory, name+".tsv.gz")
+
+	tmp, err := os.CreateTemp(r.archiveDirectory, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+
+	err = r.db.ArchivePartition(ctx, name, gz)
+	if err != nil {
+		return err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"test_task/internal/app/database"
+	"test_task/internal/app/directory"
+	pb "test_task/proto"
+)
+
+const defaultFilesLimit = 100
+
+// Admin exposes the ingestion ledger and lets clients feed files to the parser
+type Admin struct {
+	db  database.IDatabase
+	dir *directory.FilesDirectory
+}
+
+func newAdmin(db database.IDatabase, dir *directory.FilesDirectory) *Admin {
+	admin := &Admin{}
+
+	admin.db = db
+	admin.dir = dir
+
+	return admin
+}
+
+func (a *Admin) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultFilesLimit
+	}
+
+	files, err := a.db.ListFiles(ctx, database.FilesFilter{
+		Status: req.Status,
+		Name:   req.Name,
+		Offset: limit * req.Page,
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListFilesResponse{}
+	for i := range files {
+		resp.Files = append(resp.Files, fileToProto(&files[i]))
+	}
+
+	return resp, nil
+}
+
+func (a *Admin) GetFile(ctx context.Context, req *pb.FileRequest) (*pb.GetFileResponse, error) {
+	file, fileErrors, err := a.db.GetFile(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, status.Errorf(codes.NotFound, "file %q not found", req.Name)
+	}
+
+	resp := &pb.GetFileResponse{File: fileToProto(file)}
+	for _, fileError := range fileErrors {
+		resp.Errors = append(resp.Errors, &pb.FileError{Line: int32(fileError.Line), Error: fileError.Error})
+	}
+
+	return resp, nil
+}
+
+func (a *Admin) ReprocessFile(ctx context.Context, req *pb.FileRequest) (*pb.FileInfo, error) {
+	file, _, err := a.db.GetFile(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, status.Errorf(codes.NotFound, "file %q not found", req.Name)
+	}
+	if file.Status != database.FileProcessed && file.Status != database.FileFailed {
+		return nil, status.Errorf(codes.FailedPrecondition, "file %q is %s", req.Name, file.Status)
+	}
+
+	err = a.db.ClearFileData(ctx, file.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	a.dir.Requeue(ctx, file.Name)
+
+	return a.fileInfo(ctx, file.Name)
+}
+
+func (a *Admin) UploadFile(stream pb.AdminService_UploadFileServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	name := req.GetName()
+	if name == "" || name != filepath.Base(name) || !strings.EqualFold(filepath.Ext(name), ".tsv") {
+		return status.Errorf(codes.InvalidArgument, "first message must contain .tsv file name, got %q", name)
+	}
+
+	filePath, err := a.dir.AddFile(stream.Context(), name, &uploadReader{stream: stream})
+	if err == directory.ErrFileExists {
+		return status.Errorf(codes.AlreadyExists, "file %q already exists", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := a.fileInfo(stream.Context(), filePath)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(info)
+}
+
+func (a *Admin) fileInfo(ctx context.Context, name string) (*pb.FileInfo, error) {
+	file, _, err := a.db.GetFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, status.Errorf(codes.NotFound, "file %q not found", name)
+	}
+
+	return fileToProto(file), nil
+}
+
+func fileToProto(file *database.File) *pb.FileInfo {
+	info := &pb.FileInfo{
+		Name:         file.Name,
+		Status:       file.Status,
+		RowsTotal:    int32(file.RowsTotal),
+		RowsParsed:   int32(file.RowsParsed),
+		RowsRejected: int32(file.RowsRejected),
+		Error:        file.Error,
+		AddedAt:      timestamppb.New(file.AddedAt),
+	}
+	if file.ProcessedAt != nil {
+		info.ProcessedAt = timestamppb.New(*file.ProcessedAt)
+	}
+
+	return info
+}
+
+// uploadReader reads file content from the chunks of the upload stream
+type uploadReader struct {
+	stream pb.AdminService_UploadFileServer
+	buf    []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, ok := req.Data.(*pb.UploadFileRequest_Chunk); !ok {
+			return 0, status.Error(codes.InvalidArgument, "only the first message may contain file name")
+		}
+		r.buf = req.GetChunk()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
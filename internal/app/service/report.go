@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"test_task/internal/app/auth"
+	"test_task/internal/app/database"
+	"test_task/internal/app/metrics"
+	"test_task/internal/app/outfile"
+	pb "test_task/proto"
+)
+
+const (
+	defaultReportFormat = "pdf"
+	// reportChunkSize keeps messages well below the default 4 MiB limit of clients
+	reportChunkSize = 64 << 10
+)
+
+// GenerateReport renders an up-to-date report of the unit and streams it in chunks,
+// nothing is written to the output directory
+func (s *Service) GenerateReport(req *pb.GenerateReportRequest, stream pb.ApiService_GenerateReportServer) error {
+	ctx := stream.Context()
+
+	guid, err := parseGuid(req.Guid)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkUnitAccess(ctx, guid)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := s.reportRenderer(req.Format)
+	if err != nil {
+		return err
+	}
+
+	filter := database.RecordsFilter{}
+	filter.Classes = req.Classes
+	for _, level := range req.Levels {
+		filter.Levels = append(filter.Levels, int(level))
+	}
+	if req.From != nil {
+		filter.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		filter.To = req.To.AsTime()
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		return status.Error(codes.InvalidArgument, "to must be after from")
+	}
+
+	unit, err := s.db.GetUnit(ctx, guid)
+	if err != nil {
+		return err
+	}
+	if unit == nil {
+		return status.Errorf(codes.NotFound, "unit %s not found", guid)
+	}
+
+	// the whole report is kept in memory while it is rendered
+	stats, err := s.db.GetUnitStats(ctx, guid, filter)
+	if err != nil {
+		return err
+	}
+	if s.reportMaxRecords > 0 && stats.Records > s.reportMaxRecords {
+		return status.Errorf(codes.ResourceExhausted, "report has %d records, maximum is %d, narrow it with filters",
+			stats.Records, s.reportMaxRecords)
+	}
+
+	report, err := outfile.NewReport(ctx, s.db, guid, filter)
+	if err != nil {
+		return err
+	}
+	report.InvId = unit.InvId
+
+	return sendDocument(stream, renderer, report.Document())
+}
+
+// GenerateOverview renders an up-to-date overview of units available to the client and streams it in chunks
+func (s *Service) GenerateOverview(req *pb.GenerateOverviewRequest, stream pb.ApiService_GenerateOverviewServer) error {
+	ctx := stream.Context()
+
+	renderer, err := s.reportRenderer(req.Format)
+	if err != nil {
+		return err
+	}
+
+	// units of other clients are hidden like in ListUnits
+	overview, err := outfile.NewOverview(ctx, s.db, auth.FromContext(ctx).UnitsFilter())
+	if err != nil {
+		return err
+	}
+
+	return sendDocument(stream, renderer, overview.Document())
+}
+
+func (s *Service) reportRenderer(format string) (outfile.Renderer, error) {
+	if format == "" {
+		format = defaultReportFormat
+	}
+
+	renderer, ok := s.renderers[format]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown output format: %s", format)
+	}
+
+	return renderer, nil
+}
+
+// fileStream is a server stream of GenerateReportResponse
+type fileStream interface {
+	Send(*pb.GenerateReportResponse) error
+}
+
+// sendDocument renders the document completely before sending, so a failed render
+// does not leave the client with a partial file
+func sendDocument(stream fileStream, renderer outfile.Renderer, doc outfile.Document) error {
+	start := time.Now()
+	var buf bytes.Buffer
+	err := renderer.Render(&buf, doc)
+	if err != nil {
+		return status.Errorf(codes.Internal, "render %s: %v", renderer.Extension(), err)
+	}
+	metrics.RenderDuration.WithLabelValues(renderer.Extension()).Observe(time.Since(start).Seconds())
+
+	err = stream.Send(&pb.GenerateReportResponse{
+		Data: &pb.GenerateReportResponse_Name{Name: doc.Name + "." + renderer.Extension()},
+	})
+	if err != nil {
+		return err
+	}
+
+	for content := buf.Bytes(); len(content) > 0; {
+		n := reportChunkSize
+		if n > len(content) {
+			n = len(content)
+		}
+
+		err = stream.Send(&pb.GenerateReportResponse{Data: &pb.GenerateReportResponse_Chunk{Chunk: content[:n]}})
+		if err != nil {
+			return err
+		}
+
+		content = content[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"test_task/internal/app/auth"
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+	"test_task/internal/app/ratelimit"
+	pb "test_task/proto"
+)
+
+var testGuid = uuid.FromStringOrNil("1d7e4b4c-5a3e-4c4f-9b1a-6f0c2a7d8e01")
+
+// reportStream collects messages of GenerateReport
+type reportStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent []*pb.GenerateReportResponse
+}
+
+func (s *reportStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *reportStream) Send(resp *pb.GenerateReportResponse) error {
+	s.sent = append(s.sent, resp)
+	return nil
+}
+
+func newTestService(t *testing.T, records int, maxRecords int64) (*Service, *auth.Auth) {
+	t.Helper()
+	ctx := context.Background()
+
+	db := database.NewMemory()
+	err := db.AddProcessedFile(ctx, "a.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]database.Record, 0, records)
+	for i := 0; i < records; i++ {
+		data = append(data, database.Record{N: i + 1, InvId: "inv-1", UnitGuid: testGuid, Class: "alarm"})
+	}
+	err = db.AddDataRow(ctx, "a.tsv", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authn, err := auth.New(config.Auth{Disabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter, err := ratelimit.New(config.RateLimit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(config.GRPC{}, config.OutFile{ReportMaxRecords: maxRecords}, db, nil, nil, authn, limiter, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, authn
+}
+
+// generateReport calls GenerateReport through the auth interceptor, which attaches identity of the caller
+func generateReport(s *Service, authn *auth.Auth, req *pb.GenerateReportRequest) (*reportStream, error) {
+	stream := &reportStream{ctx: context.Background()}
+	info := &grpc.StreamServerInfo{FullMethod: "/api.ApiService/GenerateReport"}
+
+	err := authn.StreamInterceptor()(s, stream, info, func(srv interface{}, ss grpc.ServerStream) error {
+		stream.ctx = ss.Context()
+		return s.GenerateReport(req, stream)
+	})
+
+	return stream, err
+}
+
+func TestGenerateReportRejectsLargeReports(t *testing.T) {
+	s, authn := newTestService(t, 3, 2)
+
+	_, err := generateReport(s, authn, &pb.GenerateReportRequest{Guid: testGuid.String(), Format: "csv"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("GenerateReport of 3 records = %v, want ResourceExhausted", err)
+	}
+
+	// filters narrow the report below the limit
+	stream, err := generateReport(s, authn, &pb.GenerateReportRequest{Guid: testGuid.String(), Format: "csv",
+		Classes: []string{"working"}})
+	if err != nil {
+		t.Fatalf("GenerateReport of filtered records: %v", err)
+	}
+	if len(stream.sent) == 0 || stream.sent[0].GetName() != testGuid.String()+".csv" {
+		t.Fatalf("GenerateReport sent %v, want the file name first", stream.sent)
+	}
+}
+
+func TestGenerateReportUnknownFormat(t *testing.T) {
+	s, authn := newTestService(t, 1, 0)
+
+	_, err := generateReport(s, authn, &pb.GenerateReportRequest{Guid: testGuid.String(), Format: "odt"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("GenerateReport in unknown format = %v, want InvalidArgument", err)
+	}
+}
@@ -4,42 +4,102 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"net"
+	"test_task/internal/app/auth"
+	"test_task/internal/app/broadcast"
+	"test_task/internal/app/config"
 	"test_task/internal/app/database"
+	"test_task/internal/app/directory"
+	"test_task/internal/app/health"
+	"test_task/internal/app/interceptor"
+	"test_task/internal/app/metrics"
+	"test_task/internal/app/outfile"
+	"test_task/internal/app/ratelimit"
 	pb "test_task/proto"
 )
 
+const defaultStreamBatchSize = 500
+
+// defaultPageSize is a page of requests without limit
+const defaultPageSize = 5
+
 type Service struct {
-	pageSize int32
-	db       database.IDatabase
+	address string
+	opts    []grpc.ServerOption
+	db      database.IDatabase
+	bc      broadcast.IBroadcaster
+	admin   *Admin
+	health  *health.Checker
+	// renderers are made once for every registered format, some of them check a licence on creation
+	renderers        map[string]outfile.Renderer
+	reportMaxRecords int64
 
 	errChan chan error
 }
 
-func New(pageSize int32, db database.IDatabase, errChan chan error) (*Service, error) {
+func New(cfg config.GRPC, outFile config.OutFile, db database.IDatabase, bc broadcast.IBroadcaster,
+	dir *directory.FilesDirectory, authn *auth.Auth, limiter *ratelimit.Limiter, checker *health.Checker,
+	errChan chan error) (*Service, error) {
 	serv := &Service{}
 
-	serv.pageSize = pageSize
+	var err error
+	serv.opts, err = serverOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	requestIDUnary, requestIDStream := interceptor.RequestID()
+	loggingUnary, loggingStream := interceptor.Logging()
+	recoveryUnary, recoveryStream := interceptor.Recovery()
+
+	serv.opts = append(serv.opts,
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), requestIDUnary, loggingUnary,
+			metrics.UnaryInterceptor(), recoveryUnary, authn.UnaryInterceptor(), limiter.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(otelgrpc.StreamServerInterceptor(), requestIDStream, loggingStream,
+			metrics.StreamInterceptor(), recoveryStream, authn.StreamInterceptor(), limiter.StreamInterceptor()))
+	serv.health = checker
+	serv.address = cfg.Address
+
+	serv.reportMaxRecords = outFile.ReportMaxRecords
 	serv.db = db
+	serv.bc = bc
+	serv.admin = newAdmin(db, dir)
 	serv.errChan = errChan
 
+	serv.renderers = make(map[string]outfile.Renderer)
+	for _, format := range outfile.Formats() {
+		serv.renderers[format], err = outfile.NewRenderer(outFile, format)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s renderer", format)
+		}
+	}
+
 	return serv, nil
 }
 
 func (s *Service) Run() {
-	listener, err := net.Listen("tcp", ":5300")
+	listener, err := net.Listen("tcp", s.address)
 	if err != nil {
 		s.errChan <- err
 		return
 	}
 
-	opts := []grpc.ServerOption{}
-	grpcServer := grpc.NewServer(opts...)
+	grpcServer := grpc.NewServer(s.opts...)
 
 	pb.RegisterApiServiceServer(grpcServer, s)
+	pb.RegisterAdminServiceServer(grpcServer, s.admin)
+	healthpb.RegisterHealthServer(grpcServer, s.health.Server())
+	reflection.Register(grpcServer)
 	err = grpcServer.Serve(listener)
 	if err != nil {
 		s.errChan <- err
@@ -48,17 +108,202 @@ func (s *Service) Run() {
 }
 
 func (s *Service) GetData(ctx context.Context, req *pb.DataRequest) (*pb.DataResponse, error) {
-	offset := s.pageSize * req.Page
-	guid, err := uuid.FromString(req.Guid)
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	guid, err := parseGuid(req.Guid)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := s.db.GetDataAPI(ctx, guid, offset, req.Limit)
+	err = s.checkUnitAccess(ctx, guid)
 	if err != nil {
 		return nil, err
 	}
 
+	data, err := s.db.GetDataAPI(ctx, guid, limit*req.Page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	arrSt, err := recordsToStructs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DataResponse{Data: arrSt}, nil
+}
+
+func (s *Service) StreamData(req *pb.StreamDataRequest, stream pb.ApiService_StreamDataServer) error {
+	if len(req.Guids) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one guid is required")
+	}
+
+	guids := make([]uuid.UUID, 0, len(req.Guids))
+	for _, strGuid := range req.Guids {
+		guid, err := parseGuid(strGuid)
+		if err != nil {
+			return err
+		}
+
+		err = s.checkUnitAccess(stream.Context(), guid)
+		if err != nil {
+			return err
+		}
+
+		guids = append(guids, guid)
+	}
+
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultStreamBatchSize
+	}
+
+	// Send blocks until the client has window for the message, so reading from
+	// the database cursor is throttled by the slowest consumer
+	return s.db.StreamRecordsByGuids(stream.Context(), guids, batchSize, func(records []database.Record) error {
+		arrSt, err := recordsToStructs(records)
+		if err != nil {
+			return err
+		}
+
+		return stream.Send(&pb.DataResponse{Data: arrSt})
+	})
+}
+
+func (s *Service) WatchUnit(req *pb.WatchRequest, stream pb.ApiService_WatchUnitServer) error {
+	filter := broadcast.Filter{}
+	filter.Classes = req.Classes
+
+	if req.Guid != "" {
+		guid, err := parseGuid(req.Guid)
+		if err != nil {
+			return err
+		}
+
+		err = s.checkUnitAccess(stream.Context(), guid)
+		if err != nil {
+			return err
+		}
+		filter.Guid = guid
+	} else if identity := auth.FromContext(stream.Context()); !identity.AllowsAll() {
+		filter.Allowed = func(record *database.Record) bool {
+			return identity.Allows(record.UnitGuid, record.InvId)
+		}
+	}
+
+	for _, level := range req.Levels {
+		filter.Levels = append(filter.Levels, int(level))
+	}
+
+	sub := s.bc.Subscribe(filter)
+	defer s.bc.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case record, ok := <-sub.Records():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+
+			arrSt, err := recordsToStructs([]database.Record{record})
+			if err != nil {
+				return err
+			}
+
+			err = stream.Send(&pb.DataResponse{Data: arrSt})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Service) ListUnits(ctx context.Context, req *pb.ListUnitsRequest) (*pb.ListUnitsResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	// units of other clients are filtered by the query, so pages are not shortened by access rules
+	units, err := s.db.GetUnits(ctx, auth.FromContext(ctx).UnitsFilter(), limit*req.Page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListUnitsResponse{}
+	for i := range units {
+		resp.Units = append(resp.Units, unitToProto(&units[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *Service) GetUnit(ctx context.Context, req *pb.UnitRequest) (*pb.Unit, error) {
+	guid, err := parseGuid(req.Guid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkUnitAccess(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+
+	unit, err := s.db.GetUnit(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	if unit == nil {
+		return nil, status.Errorf(codes.NotFound, "unit %s not found", guid)
+	}
+
+	return unitToProto(unit), nil
+}
+
+// checkUnitAccess matches guid against the rules of the client, invid of
+// the unit is read from the database only when guid itself is not allowed
+func (s *Service) checkUnitAccess(ctx context.Context, guid uuid.UUID) error {
+	identity := auth.FromContext(ctx)
+	if identity.AllowsAll() || identity.AllowsGuid(guid) {
+		return nil
+	}
+
+	unit, err := s.db.GetUnit(ctx, guid)
+	if err != nil {
+		return err
+	}
+	if unit != nil && identity.Allows(guid, unit.InvId) {
+		return nil
+	}
+
+	return status.Errorf(codes.PermissionDenied, "access to unit %s is denied", guid)
+}
+
+func parseGuid(str string) (uuid.UUID, error) {
+	guid, err := uuid.FromString(str)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid guid %q: %v", str, err)
+	}
+
+	return guid, nil
+}
+
+func unitToProto(unit *database.Unit) *pb.Unit {
+	return &pb.Unit{
+		Guid:      unit.Guid.String(),
+		Invid:     unit.InvId,
+		Records:   unit.Records,
+		FirstSeen: timestamppb.New(unit.FirstSeen),
+		LastSeen:  timestamppb.New(unit.LastSeen),
+	}
+}
+
+func recordsToStructs(data []database.Record) ([]*structpb.Struct, error) {
 	var arrSt []*structpb.Struct
 	for _, row := range data {
 		jsonRow, err := json.Marshal(row)
@@ -71,9 +316,9 @@ func (s *Service) GetData(ctx context.Context, req *pb.DataRequest) (*pb.DataRes
 		if err != nil {
 			return nil, err
 		}
-		
+
 		arrSt = append(arrSt, st)
 	}
 
-	return &pb.DataResponse{Data: arrSt}, nil
+	return arrSt, nil
 }
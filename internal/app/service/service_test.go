@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	pb "test_task/proto"
+)
+
+func TestGetDataPages(t *testing.T) {
+	s, authn := newTestService(t, 12, 0)
+	info := &grpc.UnaryServerInfo{FullMethod: "/api.ApiService/GetData"}
+
+	tests := []struct {
+		page, limit int32
+		first, last float64
+	}{
+		{0, 5, 1, 5},
+		{1, 5, 6, 10},
+		{1, 10, 11, 12},
+		// requests without limit get the default page
+		{2, 0, 11, 12},
+	}
+	for _, tt := range tests {
+		req := &pb.DataRequest{Guid: testGuid.String(), Page: tt.page, Limit: tt.limit}
+		resp, err := authn.UnaryInterceptor()(context.Background(), req, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return s.GetData(ctx, req.(*pb.DataRequest))
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := resp.(*pb.DataResponse).Data
+		if len(data) == 0 {
+			t.Fatalf("page %d of %d is empty", tt.page, tt.limit)
+		}
+		first := data[0].Fields["N"].GetNumberValue()
+		last := data[len(data)-1].Fields["N"].GetNumberValue()
+		if first != tt.first || last != tt.last {
+			t.Fatalf("page %d of %d has records %v..%v, want %v..%v", tt.page, tt.limit, first, last, tt.first, tt.last)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rule constrains one column of a row, parts of the rule which are not set check nothing.
+// Empty values which are not required are not checked at all
+type Rule struct {
+	Required bool     `json:"required"`
+	Allowed  []string `json:"allowed"`
+	// Min and Max bound values of integer columns
+	Min *int `json:"min"`
+	Max *int `json:"max"`
+	// Pattern is a regular expression the whole value has to match
+	Pattern   string `json:"pattern"`
+	MaxLength int    `json:"max_length"`
+
+	pattern *regexp.Regexp
+}
+
+type rulesFile struct {
+	// Fields are rules by column name
+	Fields map[string]*Rule `json:"fields"`
+}
+
+// FieldError is a failed rule of one column
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Errors are all failed rules of a row in order of columns
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Fields returns names of columns which failed
+func (e Errors) Fields() []string {
+	fields := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		fields = append(fields, fieldError.Field)
+	}
+
+	return fields
+}
+
+// Validator checks rows against default rules and rules loaded from a file
+type Validator struct {
+	// rules are indexed by column, columns without rules have nil
+	rules   []*Rule
+	columns []string
+}
+
+// New returns validator of columns with the default rules, a rule of the JSON file at path replaces
+// the default rule of its column and a column with {} in the file is not checked at all.
+// numeric are columns with integer values, only they may have min and max
+func New(path string, columns []string, numeric []string, defaults map[string]Rule) (*Validator, error) {
+	v := &Validator{}
+
+	v.columns = columns
+	v.rules = make([]*Rule, len(columns))
+
+	rules := make(map[string]*Rule, len(defaults))
+	for field, rule := range defaults {
+		rule := rule
+		rules[field] = &rule
+	}
+
+	if path == "" {
+		log.Print("default validation rules are used, VALIDATION_RULES_FILE is not set")
+	} else {
+		file, err := loadRules(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for field, rule := range file.Fields {
+			if rule == nil {
+				rule = &Rule{}
+			}
+			rules[field] = rule
+		}
+	}
+
+	index := make(map[string]int)
+	for i, column := range columns {
+		index[column] = i
+	}
+
+	for field, rule := range rules {
+		i, ok := index[field]
+		if !ok {
+			return nil, errors.Errorf("validation rule of unknown column %s", field)
+		}
+
+		err := rule.compile(contains(numeric, field))
+		if err != nil {
+			return nil, errors.Wrapf(err, "validation rule of %s", field)
+		}
+
+		v.rules[i] = rule
+	}
+
+	return v, nil
+}
+
+func loadRules(path string) (*rulesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read validation rules file")
+	}
+
+	var file rulesFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse validation rules file")
+	}
+
+	return &file, nil
+}
+
+func (r *Rule) compile(numeric bool) error {
+	if !numeric && (r.Min != nil || r.Max != nil) {
+		return errors.New("min and max are allowed only for integer columns")
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return errors.Errorf("min %d is greater than max %d", *r.Min, *r.Max)
+	}
+
+	if r.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+		if err != nil {
+			return err
+		}
+		r.pattern = pattern
+	}
+
+	return nil
+}
+
+// Validate checks cells of the row, it returns Errors with every failed rule or nil
+func (v *Validator) Validate(row []string) error {
+	var failed Errors
+	for i, rule := range v.rules {
+		if rule == nil || i >= len(row) {
+			continue
+		}
+
+		message := rule.check(strings.TrimSpace(row[i]))
+		if message != "" {
+			failed = append(failed, FieldError{Field: v.columns[i], Message: message})
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+
+	return nil
+}
+
+// check returns description of the failed rule or empty string when value is valid
+func (r *Rule) check(value string) string {
+	if value == "" {
+		if r.Required {
+			return "is required"
+		}
+		return ""
+	}
+
+	if len(r.Allowed) > 0 && !contains(r.Allowed, value) {
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(r.Allowed, ", "))
+	}
+
+	if r.MaxLength > 0 && len([]rune(value)) > r.MaxLength {
+		return fmt.Sprintf("is longer than %d characters", r.MaxLength)
+	}
+
+	if r.pattern != nil && !r.pattern.MatchString(value) {
+		return fmt.Sprintf("%q does not match %s", value, r.Pattern)
+	}
+
+	if r.Min != nil || r.Max != nil {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Sprintf("%q is not an integer", value)
+		}
+		if (r.Min != nil && n < *r.Min) || (r.Max != nil && n > *r.Max) {
+			return fmt.Sprintf("%d is out of range %s..%s", n, bound(r.Min), bound(r.Max))
+		}
+	}
+
+	return ""
+}
+
+func bound(b *int) string {
+	if b == nil {
+		return ""
+	}
+
+	return strconv.Itoa(*b)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
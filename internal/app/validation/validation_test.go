@@ -0,0 +1,147 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestRuleCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		value   string
+		message string
+	}{
+		{"empty rule", Rule{}, "anything", ""},
+		{"required present", Rule{Required: true}, "x", ""},
+		{"required missing", Rule{Required: true}, "", "is required"},
+		{"optional empty is not checked", Rule{Allowed: []string{"a"}, Min: intPtr(1)}, "", ""},
+		{"allowed", Rule{Allowed: []string{"alarm", "working"}}, "working", ""},
+		{"not allowed", Rule{Allowed: []string{"alarm", "working"}}, "Alarm", `"Alarm" is not one of alarm, working`},
+		{"max length", Rule{MaxLength: 3}, "абв", ""},
+		{"too long", Rule{MaxLength: 3}, "абвг", "is longer than 3 characters"},
+		{"pattern", Rule{Pattern: `[a-z]+(\.[a-z]+)*`}, "a.b", ""},
+		{"pattern is anchored", Rule{Pattern: `[a-z]+`}, "a b", `"a b" does not match [a-z]+`},
+		{"in range", Rule{Min: intPtr(0), Max: intPtr(31)}, "31", ""},
+		{"below min", Rule{Min: intPtr(0), Max: intPtr(31)}, "-1", "-1 is out of range 0..31"},
+		{"above max", Rule{Min: intPtr(0), Max: intPtr(1)}, "2", "2 is out of range 0..1"},
+		{"only min", Rule{Min: intPtr(5)}, "4", "4 is out of range 5.."},
+		{"not integer", Rule{Max: intPtr(1)}, "x", `"x" is not an integer`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			err := rule.compile(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message := rule.check(tt.value)
+			if message != tt.message {
+				t.Fatalf("check(%q) = %q, want %q", tt.value, message, tt.message)
+			}
+		})
+	}
+}
+
+var (
+	testColumns  = []string{"n", "class", "level", "addr"}
+	testNumeric  = []string{"n", "level"}
+	testDefaults = map[string]Rule{
+		"class": {Required: true, Allowed: []string{"alarm", "working"}},
+		"level": {Min: intPtr(0), Max: intPtr(100)},
+	}
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestValidateDefaultRules(t *testing.T) {
+	v, err := New("", testColumns, testNumeric, testDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.Validate([]string{"1", "alarm", "5", "a.b"})
+	if err != nil {
+		t.Fatalf("valid row: %v", err)
+	}
+
+	err = v.Validate([]string{"1", "bogus", "500", ""})
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Validate = %v, want Errors", err)
+	}
+	if !reflect.DeepEqual(errs.Fields(), []string{"class", "level"}) {
+		t.Fatalf("failed fields = %v, want [class level] in order of columns", errs.Fields())
+	}
+	want := `class: "bogus" is not one of alarm, working; level: 500 is out of range 0..100`
+	if err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestValidateFileReplacesDefaults(t *testing.T) {
+	path := writeRules(t, `{"fields": {"class": {}, "level": {"max": 10}, "addr": {"required": true}}}`)
+
+	v, err := New(path, testColumns, testNumeric, testDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.Validate([]string{"1", "", "-5", "a"})
+	if err != nil {
+		t.Fatalf("class and min of level are not checked with the file: %v", err)
+	}
+
+	err = v.Validate([]string{"1", "alarm", "11", ""})
+	errs, ok := err.(Errors)
+	if !ok || !reflect.DeepEqual(errs.Fields(), []string{"level", "addr"}) {
+		t.Fatalf("Validate = %v, want errors of level and addr", err)
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"unknown column", `{"fields": {"color": {"required": true}}}`},
+		{"min of string column", `{"fields": {"class": {"min": 1}}}`},
+		{"min above max", `{"fields": {"level": {"min": 5, "max": 1}}}`},
+		{"invalid pattern", `{"fields": {"addr": {"pattern": "("}}}`},
+		{"invalid json", `{"fields": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(writeRules(t, tt.rules), testColumns, testNumeric, testDefaults)
+			if err == nil {
+				t.Fatal("New must fail")
+			}
+		})
+	}
+}
+
+func TestNewMissingFile(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), testColumns, testNumeric, testDefaults)
+	if err == nil {
+		t.Fatal("New must fail when the file is missing")
+	}
+}
@@ -3,20 +3,43 @@ package app
 import (
 	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"test_task/internal/app/auth"
+	"test_task/internal/app/broadcast"
 	"test_task/internal/app/config"
 	"test_task/internal/app/database"
 	"test_task/internal/app/directory"
+	"test_task/internal/app/gateway"
+	"test_task/internal/app/health"
+	"test_task/internal/app/metrics"
 	"test_task/internal/app/parser"
+	"test_task/internal/app/ratelimit"
+	"test_task/internal/app/retention"
 	"test_task/internal/app/service"
+	"test_task/internal/app/tracing"
 )
 
+// shutdownTimeout bounds the time spent flushing state after a signal
+const shutdownTimeout = 10 * time.Second
+
 type App struct {
 	cfg *config.Config
-	db  *database.Postgres
+	db  database.IDatabase
 	dir *directory.FilesDirectory
 	s   *service.Service
 	par *parser.Parser
+	bc  broadcast.IBroadcaster
+	gw  *gateway.Gateway
+	hc  *health.Checker
+	ms  *metrics.Server
+	rt  *retention.Retention
+
+	// shutdownTracing flushes batched spans and closes the exporter
+	shutdownTracing func(context.Context) error
 
 	errors chan error
 }
@@ -32,25 +55,68 @@ func New() (*App, error) {
 		return nil, err
 	}
 
-	a.db, err = database.New(&a.cfg.Database, ctx)
+	a.db, err = database.Open(&a.cfg.Database, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.shutdownTracing, err = tracing.New(ctx, a.cfg.Tracing)
 	if err != nil {
 		return nil, err
 	}
 
-	queue := make(chan string, 1024)
 	a.errors = make(chan error)
 
+	a.rt, err = retention.New(ctx, a.cfg.Retention, a.db, a.errors)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make(chan directory.QueuedFile, 1024)
+	queueDepth := func() int { return len(queue) }
+	metrics.RegisterQueueDepth(queueDepth)
+
 	a.dir, err = directory.New(ctx, a.cfg.FilesDirectory, queue, a.db, a.errors)
 	if err != nil {
 		return nil, err
 	}
 
-	a.par, err = parser.New(a.cfg.Parser, queue, a.errors, a.db)
+	a.bc, err = broadcast.New(a.cfg.Watch, a.db, a.errors)
+	if err != nil {
+		return nil, err
+	}
+
+	a.par, err = parser.New(a.cfg.Parser, queue, a.errors, a.db, a.bc)
 	if err != nil {
 		return nil, err
 	}
 
-	a.s, err = service.New(5, a.db, a.errors)
+	authn, err := auth.New(a.cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	a.hc, err = health.New(a.cfg.Health, a.db, a.dir, queueDepth, a.errors)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, err := ratelimit.New(a.cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	a.s, err = service.New(a.cfg.GRPC, a.cfg.Parser.OutFile, a.db, a.bc, a.dir, authn, limiter, a.hc, a.errors)
+	if err != nil {
+		return nil, err
+	}
+
+	a.gw, err = gateway.New(a.cfg.Gateway, a.errors)
+	if err != nil {
+		return nil, err
+	}
+
+	a.ms, err = metrics.New(a.cfg.Metrics, a.errors)
 	if err != nil {
 		return nil, err
 	}
@@ -59,15 +125,45 @@ func New() (*App, error) {
 }
 
 func (a *App) Run() error {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	go a.bc.Run(ctx)
 	go a.dir.Run(ctx)
 	go a.par.Run(ctx)
+	go a.hc.Run(ctx)
 	go a.s.Run()
+	go a.gw.Run(ctx)
+	go a.ms.Run(ctx)
+	go a.rt.Run(ctx)
 
 	for {
-		log.Print(<-a.errors)
+		select {
+		case err := <-a.errors:
+			log.Print(err)
+		case <-ctx.Done():
+			log.Print("shutdown")
+			return a.shutdown()
+		}
+	}
+}
+
+// shutdown waits for pending output files and flushes spans
+func (a *App) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for done := false; !done; {
+		select {
+		case err := <-a.errors:
+			log.Print(err)
+		case <-a.par.Done():
+			done = true
+		case <-ctx.Done():
+			log.Print("output files are not flushed before shutdown timeout")
+			done = true
+		}
 	}
 
-	return nil
+	return a.shutdownTracing(ctx)
 }
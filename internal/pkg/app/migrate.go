@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"test_task/internal/app/config"
+	"test_task/internal/app/database"
+)
+
+// Migrate runs "migrate up|down [N]|status" command against configured database
+func Migrate(args []string) error {
+	ctx := context.Background()
+
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+	cfg.Database.AutoMigrate = false
+
+	db, err := database.Open(&cfg.Database, ctx)
+	if err != nil {
+		return err
+	}
+
+	migrator, ok := db.(database.Migrator)
+	if !ok {
+		return errors.Errorf("%s database has no migrations", cfg.Database.Driver)
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.MigrateUp(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		return migrator.MigrateDown(ctx, steps)
+	case "status":
+		statuses, err := migrator.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown migrate command: %s, expected up, down [N] or status", command)
+	}
+}
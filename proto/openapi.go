@@ -0,0 +1,8 @@
+package __
+
+import _ "embed"
+
+// OpenAPI is the description of HTTP/JSON gateway generated from api.proto
+//
+//go:embed api.swagger.json
+var OpenAPI []byte